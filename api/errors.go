@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import "net/http"
+
+// Error codes returned in ResponseErrorData. They are part of the API and
+// must not change.
+const (
+	ErrorInvalidRequest      = "invalid_request"
+	ErrorInvalidFileID       = "invalid_file_id"
+	ErrorNotFound            = "not_found"
+	ErrorFileNotFound        = "file_not_found"
+	ErrorFileExpired         = "file_expired"
+	ErrorCollectionNotFound  = "collection_not_found"
+	ErrorProjectNotFound     = "project_not_found"
+	ErrorCollectionConflict  = "collection_conflict"
+	ErrorWebhookNotFound     = "webhook_not_found"
+	ErrorWebhookTargetDenied = "webhook_target_denied"
+	ErrorUploadTooLarge      = "upload_too_large"
+	ErrorInvalidArchive      = "invalid_archive"
+	ErrorArchiveTooLarge     = "archive_too_large"
+	ErrorEntryNotFound       = "entry_not_found"
+	ErrorRequestCanceled     = "request_canceled"
+	ErrorInternal            = "internal_error"
+	ErrorStorage             = "storage_error"
+	ErrorStorageUnavailable  = "storage_unavailable"
+	ErrorStorageTimeout      = "storage_timeout"
+)
+
+// Error is an error with a stable code and a message that is safe to show
+// to users. The underlying error is only logged.
+type Error struct {
+	Code    string
+	Message string
+	Details map[string]interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetail adds a detail to the error response.
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// statusErrorCode is the code of errors without one of their own.
+func statusErrorCode(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return ErrorNotFound
+	case status == http.StatusGone:
+		return ErrorFileExpired
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrorUploadTooLarge
+	case status == http.StatusServiceUnavailable:
+		return ErrorStorageUnavailable
+	case status == http.StatusGatewayTimeout:
+		return ErrorStorageTimeout
+	case status < 500:
+		return ErrorInvalidRequest
+	}
+	return ErrorInternal
+}
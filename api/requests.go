@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+// @Description Collection to be created or updated
+type RequestCollection struct {
+	// Name of collection (must not contain slashes)
+	Name string `json:"name" binding:"required"`
+	// ID of parent collection, empty for the top level. Updates that omit it
+	// keep the current parent.
+	ParentID *string `json:"parentID"`
+}
+
+// @Description Target of a file move
+type RequestMoveFile struct {
+	// ID of target collection, empty for the top level
+	CollectionID string `json:"collectionID"`
+}
+
+// @Description Expiry of a file, both empty to keep the file
+type RequestExpiry struct {
+	// Time at which the file expires (RFC 3339)
+	ExpiresAt string `json:"expiresAt"`
+	// Time to live from now, e.g. "72h", instead of expiresAt
+	TTL string `json:"ttl"`
+}
+
+// @Description Operation on many files, selected by ID or by a filter
+type RequestBulk struct {
+	// "delete", "tag", "move" or "expire"
+	Operation string `json:"operation" binding:"required"`
+	// IDs of the files, instead of a filter
+	FileIDs []string `json:"fileIDs"`
+	// Selects the files if no IDs are given
+	Filter *RequestBulkFilter `json:"filter"`
+	// Tags to set for "tag"
+	Tags map[string]string `json:"tags"`
+	// Keys of the tags to remove for "tag"
+	RemoveTags []string `json:"removeTags"`
+	// ID of target collection for "move", empty for the top level
+	CollectionID string `json:"collectionID"`
+	// Time at which the files expire for "expire" (RFC 3339)
+	ExpiresAt string `json:"expiresAt"`
+	// Time to live from now for "expire", instead of expiresAt; both empty
+	// to keep the files
+	TTL string `json:"ttl"`
+}
+
+// @Description Files matching all the given conditions
+type RequestBulkFilter struct {
+	// Only files directly inside this collection, empty for the top level
+	CollectionID *string `json:"collectionID"`
+	// Only files with this tag, given as key=value
+	Tag string `json:"tag"`
+	// Only files whose path (collections and name) starts with this prefix
+	Prefix string `json:"prefix"`
+}
+
+// @Description Target of a file copy. Omitted fields are taken from the
+// @Description original file.
+type RequestCopyFile struct {
+	// ID of project to copy the file to, empty for the same project
+	ProjectID string `json:"projectID"`
+	// ID of collection to place the copy in, empty for the top level. By
+	// default the copy is placed next to the original, or at the top level of
+	// another project.
+	CollectionID *string `json:"collectionID"`
+	// Name of the copy
+	Name *string `json:"name"`
+	// Tags of the copy
+	Tags map[string]string `json:"tags"`
+	// Time at which the copy expires (RFC 3339), by default it is kept
+	ExpiresAt string `json:"expiresAt"`
+	// Time to live of the copy, instead of expiresAt
+	TTL string `json:"ttl"`
+}
+
+// @Description Files to download as one archive, selected by ID or by a
+// @Description filter
+type RequestDownload struct {
+	// Archive format: "zip" (default) or "tar.gz"
+	Format string `json:"format"`
+	// IDs of the files, instead of a filter
+	FileIDs []string `json:"fileIDs"`
+	// Selects the files if no IDs are given
+	Filter *RequestBulkFilter `json:"filter"`
+}
+
+// @Description Subscription to the events of files
+type RequestWebhook struct {
+	// URL the events are posted to, http or https
+	URL string `json:"url" binding:"required"`
+	// Secret to sign the events with, generated if empty
+	Secret string `json:"secret"`
+	// Types of events to send, all if empty: file.created, file.updated,
+	// file.deleted and file.metadata_changed
+	Events []string `json:"events"`
+	// Only events of files in this project, "" for those outside of projects
+	ProjectID *string `json:"projectID"`
+	// Only events of files whose path (collections and name) starts with
+	// this prefix
+	Prefix string `json:"prefix"`
+	// Only events of files with this tag, given as key=value
+	Tag string `json:"tag"`
+}
@@ -3,16 +3,29 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/sogno-platform/file-service/logging"
 )
 
 type ResponseErrorData struct {
 	// HTTP response status code
 	Code int `json:"code" validate:"required"`
+	// Stable code of the error, e.g. "file_not_found"
+	ErrorCode string `json:"errorCode" validate:"required"`
 	// Description of the error
 	Message string `json:"message" validate:"required"`
+	// Further information depending on the error code
+	Details map[string]interface{} `json:"details,omitempty"`
+	// ID of the request, to be quoted in bug reports
+	RequestID string `json:"requestID,omitempty"`
 }
 
 // @Description An error
@@ -20,13 +33,42 @@ type ResponseError struct {
 	Error ResponseErrorData `json:"error" validate:"required"`
 }
 
+type ResponseBulkResult struct {
+	// ID of file
+	FileID string `json:"fileID" validate:"required"`
+	// HTTP status code of the operation on this file
+	Code int `json:"code" validate:"required"`
+	// Why the operation failed on this file
+	Error *ResponseErrorData `json:"error,omitempty"`
+}
+
+// @Description Results of a bulk operation by file. With "Accept:
+// @Description application/x-ndjson" each result is streamed as a line instead.
+type ResponseBulk struct {
+	Data []ResponseBulkResult `json:"data"`
+}
+
 type ResponseFileData struct {
 	// ID of file
 	FileID string `json:"fileID" validate:"required"`
 	// Last modified timestamp of file
 	LastModified time.Time `json:"lastModified" validate:"required"`
+	// Size of file in bytes
+	Size int64 `json:"size"`
 	// URL of file
 	URL string `json:"url,omitempty"`
+	// Original name of file
+	Name string `json:"name,omitempty"`
+	// ID of collection the file is placed in, omitted for the top level
+	CollectionID string `json:"collectionID,omitempty"`
+	// Tags of file
+	Tags map[string]string `json:"tags,omitempty"`
+	// Time at which the file expires, omitted if it is kept
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Time at which the file was moved to the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Time at which the file is purged from the trash
+	PurgeAt *time.Time `json:"purgeAt,omitempty"`
 }
 
 // @Description A single file
@@ -34,6 +76,34 @@ type ResponseFile struct {
 	Data ResponseFileData `json:"data" validate:"required"`
 }
 
+type ResponseExtractData struct {
+	// ID of the collection the archive was extracted into
+	CollectionID string `json:"collectionID" validate:"required"`
+	// IDs of the extracted files
+	FileIDs []string `json:"fileIDs" validate:"required"`
+	// The archive itself, if it was kept
+	Archive *ResponseFileData `json:"archive,omitempty"`
+}
+
+// @Description Files extracted from an archive
+type ResponseExtract struct {
+	Data ResponseExtractData `json:"data" validate:"required"`
+}
+
+type ResponseArchiveEntryData struct {
+	// Path of the entry inside the archive
+	Path string `json:"path" validate:"required"`
+	// Size of the entry in bytes, uncompressed
+	Size int64 `json:"size"`
+	// Last modified timestamp of the entry
+	LastModified time.Time `json:"lastModified"`
+}
+
+// @Description Files inside an archive
+type ResponseArchiveEntries struct {
+	Data []ResponseArchiveEntryData `json:"data"`
+}
+
 // @Description Multiple files (NOTE: Partial responses are possible.
 // @Description  In this case `data` and `error` will be returned.)
 type ResponseFiles struct {
@@ -41,16 +111,163 @@ type ResponseFiles struct {
 	Error *ResponseErrorData `json:"error,omitempty"`
 }
 
+type ResponseCollectionData struct {
+	// ID of collection
+	CollectionID string `json:"collectionID" validate:"required"`
+	// Name of collection
+	Name string `json:"name" validate:"required"`
+	// ID of parent collection, omitted for top-level collections
+	ParentID string `json:"parentID,omitempty"`
+	// Names of all collections from the top level down to this one,
+	// separated by slashes
+	Path string `json:"path" validate:"required"`
+	// Creation timestamp of collection
+	CreatedAt time.Time `json:"createdAt" validate:"required"`
+}
+
+// @Description A single collection
+type ResponseCollection struct {
+	Data ResponseCollectionData `json:"data" validate:"required"`
+}
+
+type ResponseCollectionContentsData struct {
+	// Collections directly inside the listed collection
+	Collections []ResponseCollectionData `json:"collections"`
+	// Files directly inside the listed collection
+	Files []ResponseFileData `json:"files"`
+}
+
+// @Description Contents of a collection (not recursive)
+type ResponseCollectionContents struct {
+	Data ResponseCollectionContentsData `json:"data" validate:"required"`
+}
+
+type ResponseProjectData struct {
+	// ID of project
+	ProjectID string `json:"projectID" validate:"required"`
+	// Display name of project
+	Name string `json:"name" validate:"required"`
+}
+
+// @Description A single project
+type ResponseProject struct {
+	Data ResponseProjectData `json:"data" validate:"required"`
+}
+
+// @Description Multiple projects
+type ResponseProjects struct {
+	Data []ResponseProjectData `json:"data" validate:"required"`
+}
+
+type ResponseWebhookData struct {
+	// ID of webhook
+	WebhookID string `json:"webhookID" validate:"required"`
+	// URL the events are posted to
+	URL string `json:"url" validate:"required"`
+	// Secret the events are signed with, only returned when the webhook is
+	// created
+	Secret string `json:"secret,omitempty"`
+	// Types of events sent, all if empty
+	Events []string `json:"events"`
+	// Only events of files in this project, "" for those outside of
+	// projects
+	ProjectID *string `json:"projectID,omitempty"`
+	// Only events of files whose path starts with this prefix
+	Prefix string `json:"prefix,omitempty"`
+	// Only events of files with this tag, as key=value
+	Tag       string    `json:"tag,omitempty"`
+	CreatedAt time.Time `json:"createdAt" validate:"required"`
+}
+
+// @Description A single webhook
+type ResponseWebhook struct {
+	Data ResponseWebhookData `json:"data" validate:"required"`
+}
+
+// @Description Multiple webhooks
+type ResponseWebhooks struct {
+	Data []ResponseWebhookData `json:"data"`
+}
+
+type ResponseDeliveryData struct {
+	// ID of delivery, sent as X-Sogno-Delivery
+	DeliveryID string `json:"deliveryID" validate:"required"`
+	EventID    string `json:"eventID" validate:"required"`
+	EventType  string `json:"eventType" validate:"required"`
+	FileID     string `json:"fileID"`
+	// "pending" while attempts are left, "delivered" or "failed"
+	Status string `json:"status" validate:"required"`
+	// Number of attempts so far
+	Attempts int `json:"attempts"`
+	// HTTP status code of the last attempt, if it got a response
+	StatusCode int `json:"statusCode,omitempty"`
+	// Why the last attempt failed
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt" validate:"required"`
+	UpdatedAt time.Time `json:"updatedAt" validate:"required"`
+}
+
+// @Description Latest deliveries of a webhook, most recent first
+type ResponseDeliveries struct {
+	Data []ResponseDeliveryData `json:"data"`
+}
+
 // @Description Empty successful response
 type ResponseEmpty struct {
 	Data struct{} `json:"data" validate:"required"`
 }
 
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+type ResponseHealthCheck struct {
+	// "ok" or "fail"
+	Status string `json:"status" validate:"required"`
+	// Why the check failed
+	Error string `json:"error,omitempty"`
+}
+
+// @Description Health of the service and its dependencies
+type ResponseHealth struct {
+	// "ok" or "fail"
+	Status string `json:"status" validate:"required"`
+	// Results of the individual checks by name
+	Checks map[string]ResponseHealthCheck `json:"checks,omitempty"`
+}
+
+// ErrorJSON writes an error response and logs err.
 func ErrorJSON(c *gin.Context, code int, err error) {
-	c.PureJSON(code, ResponseError{
-		Error: ResponseErrorData{
-			Code:    code,
-			Message: err.Error(),
-		},
-	})
+	ctx := c.Request.Context()
+	level := slog.LevelInfo
+	if code >= 500 {
+		level = slog.LevelError
+	}
+
+	data := ErrorData(ctx, code, err)
+	logging.FromContext(ctx).Log(ctx, level, "request failed",
+		"status", code, "error_code", data.ErrorCode, "error", err)
+
+	c.PureJSON(code, ResponseError{Error: data})
+}
+
+// ErrorData describes an error with status code. Errors other than Error
+// get a code derived from the status, and for server errors a generic
+// message, as their text may expose internals of the object store.
+func ErrorData(ctx context.Context, code int, err error) ResponseErrorData {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = &Error{Code: statusErrorCode(code), Message: err.Error()}
+		if code >= 500 {
+			apiErr.Message = strings.ToLower(http.StatusText(code))
+		}
+	}
+	return ResponseErrorData{
+		Code:      code,
+		ErrorCode: apiErr.Code,
+		Message:   apiErr.Message,
+		Details:   apiErr.Details,
+		RequestID: logging.RequestID(ctx),
+	}
 }
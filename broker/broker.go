@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package broker publishes the events of files to an MQTT or AMQP message
+// broker. Events pass through an outbox in the bucket, so they are
+// published once the broker is reachable again.
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sogno-platform/file-service/config"
+)
+
+// Publisher sends messages to a message broker.
+type Publisher interface {
+	// Publish sends a message and returns once the broker accepted it as
+	// far as the quality of service asks for.
+	Publish(ctx context.Context, topic string, messageID string, body []byte) error
+	Close() error
+}
+
+// NewPublisher returns a publisher for the broker of settings. It does not
+// wait for the broker, which need not be up yet.
+func NewPublisher(settings config.BrokerSettings) (Publisher, error) {
+	switch settings.Type {
+	case "mqtt":
+		return newMQTTPublisher(settings), nil
+	case "amqp":
+		return newAMQPPublisher(settings), nil
+	}
+	return nil, fmt.Errorf("unknown broker type '%s'", settings.Type)
+}
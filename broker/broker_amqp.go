@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/sogno-platform/file-service/config"
+)
+
+type amqpPublisher struct {
+	url      string
+	exchange string
+	timeout  time.Duration
+	// Wait for the broker to confirm messages and mark them persistent
+	confirm bool
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func newAMQPPublisher(settings config.BrokerSettings) *amqpPublisher {
+	return &amqpPublisher{
+		url:      settings.URL,
+		exchange: settings.Exchange,
+		timeout:  settings.Timeout,
+		confirm:  settings.QoS > 0,
+	}
+}
+
+// channel returns the open channel, connecting to the broker if there is
+// none.
+func (p *amqpPublisher) channel() (*amqp.Channel, error) {
+	if p.ch != nil && !p.ch.IsClosed() {
+		return p.ch, nil
+	}
+	p.closeConn()
+	conn, err := amqp.DialConfig(p.url, amqp.Config{Dial: amqp.DefaultDial(p.timeout)})
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err == nil && p.confirm {
+		err = ch.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	p.conn, p.ch = conn, ch
+	return ch, nil
+}
+
+func (p *amqpPublisher) Publish(ctx context.Context, topic string, messageID string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, err := p.channel()
+	if err != nil {
+		return err
+	}
+	msg := amqp.Publishing{
+		ContentType: "application/json",
+		MessageId:   messageID,
+		Timestamp:   time.Now(),
+		Body:        body,
+	}
+	if !p.confirm {
+		err = ch.PublishWithContext(ctx, p.exchange, topic, false, false, msg)
+	} else {
+		msg.DeliveryMode = amqp.Persistent
+		var confirmation *amqp.DeferredConfirmation
+		confirmation, err = ch.PublishWithDeferredConfirmWithContext(ctx, p.exchange, topic, false, false, msg)
+		if err == nil {
+			var acked bool
+			acked, err = confirmation.WaitContext(ctx)
+			if err == nil && !acked {
+				err = errors.New("broker rejected the message")
+			}
+		}
+	}
+	if err != nil {
+		// Start over with a new connection
+		p.closeConn()
+	}
+	return err
+}
+
+func (p *amqpPublisher) closeConn() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn, p.ch = nil, nil
+}
+
+func (p *amqpPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closeConn()
+	return nil
+}
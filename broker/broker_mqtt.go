@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package broker
+
+import (
+	"context"
+	"errors"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/sogno-platform/file-service/config"
+)
+
+var errNotConnected = errors.New("not connected to the broker")
+
+type mqttPublisher struct {
+	client mqtt.Client
+	qos    byte
+}
+
+func newMQTTPublisher(settings config.BrokerSettings) *mqttPublisher {
+	opts := mqtt.NewClientOptions().
+		AddBroker(settings.URL).
+		SetClientID(settings.ClientID).
+		SetConnectTimeout(settings.Timeout).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(settings.RetryInterval).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(settings.RetryInterval)
+	client := mqtt.NewClient(opts)
+	// Completes once connected, the client keeps trying until then
+	client.Connect()
+	return &mqttPublisher{client: client, qos: byte(settings.QoS)}
+}
+
+func (p *mqttPublisher) Publish(ctx context.Context, topic string, messageID string, body []byte) error {
+	// The client would queue the message while reconnecting, the outbox
+	// already does that
+	if !p.client.IsConnectionOpen() {
+		return errNotConnected
+	}
+	token := p.client.Publish(topic, p.qos, false, body)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *mqttPublisher) Close() error {
+	p.client.Disconnect(250)
+	return nil
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/events"
+	"github.com/sogno-platform/file-service/file"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+)
+
+// keyPrefix is where the outbox is kept, next to the records of the files.
+const keyPrefix = ".sogno/outbox/"
+
+// queueSize is the number of written events waiting to be taken up for
+// publishing. Further events wait in the bucket.
+const queueSize = 1000
+
+// maxPending is the number of events kept in memory for publishing.
+// Further events wait in the bucket until those are published.
+const maxPending = 10000
+
+type outboxEntry struct {
+	// Key of the entry in the bucket, empty if writing it failed
+	key   string
+	event events.Event
+	body  []byte
+}
+
+// Outbox writes events to the bucket before they are published and
+// deletes them once the broker has them. While the broker is unavailable,
+// events collect in the outbox and are published in order when it is back,
+// also after a restart of the service. Events may therefore be published
+// more than once; consumers can tell them apart by their ID.
+type Outbox struct {
+	objStore  file.ObjectStore
+	bucket    string
+	publisher Publisher
+	topic     *template.Template
+	settings  config.BrokerSettings
+	queue     chan outboxEntry
+	// Set when written events were left out of pending, they are loaded
+	// from the bucket once pending is empty
+	overflow atomic.Bool
+	// Events not yet published, oldest first. Only used by Run.
+	pending []outboxEntry
+}
+
+// NewOutbox returns an outbox in bucket publishing events with publisher.
+// The events left in the outbox are published first.
+func NewOutbox(ctx context.Context, store file.ObjectStore, bucket string, publisher Publisher, settings config.BrokerSettings) (*Outbox, error) {
+	topic, err := template.New("topic").Parse(settings.Topic)
+	if err == nil {
+		// Fails for unknown fields, which would only show when publishing
+		err = topic.Execute(&strings.Builder{}, events.New(events.FileCreated))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker topic: %w", err)
+	}
+	o := &Outbox{
+		objStore:  store,
+		bucket:    bucket,
+		publisher: publisher,
+		topic:     topic,
+		settings:  settings,
+		queue:     make(chan outboxEntry, queueSize),
+	}
+	err = o.load(ctx)
+	return o, err
+}
+
+// load adds the oldest events in the bucket that are not pending yet to
+// pending, up to maxPending of them.
+func (o *Outbox) load(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objInfoChan, err := o.objStore.ListObjects(ctx, o.bucket, keyPrefix)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]bool, len(o.pending))
+	for _, entry := range o.pending {
+		pending[entry.key] = true
+	}
+	var keys []string
+	for objInfo := range objInfoChan {
+		if objInfo.Err != nil {
+			return objInfo.Err
+		}
+		if !strings.HasSuffix(objInfo.Key, "/") && !pending[objInfo.Key] {
+			keys = append(keys, objInfo.Key)
+		}
+	}
+	// Keys start with the time of the event
+	sort.Strings(keys)
+	if free := maxPending - len(o.pending); len(keys) > free {
+		keys = keys[:free]
+		o.overflow.Store(true)
+	}
+	for _, key := range keys {
+		content, err := o.objStore.GetObject(ctx, o.bucket, key)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+		entry := outboxEntry{key: key, body: buf.Bytes()}
+		if err := json.Unmarshal(entry.body, &entry.event); err != nil {
+			return fmt.Errorf("reading outbox entry %s: %w", key, err)
+		}
+		o.pending = append(o.pending, entry)
+	}
+	metrics.SetBrokerOutbox(len(o.pending))
+	return nil
+}
+
+func (o *Outbox) key(e events.Event) string {
+	return fmt.Sprintf("%s%020d-%s.json", keyPrefix, e.Time.UnixNano(), e.ID)
+}
+
+// Publish writes an event to the outbox and queues it for publishing. It
+// returns once the event is in the bucket, so the events of changes that
+// were acknowledged survive a restart. The event is written even if ctx is
+// canceled, e.g. by a client that disconnected after the change.
+func (o *Outbox) Publish(ctx context.Context, e events.Event) {
+	ctx = context.WithoutCancel(ctx)
+	body, err := json.Marshal(e)
+	if err != nil {
+		logging.FromContext(ctx).Error("encoding event", "event_id", e.ID, "error", err)
+		metrics.AddBrokerEvent("dropped")
+		return
+	}
+	entry := outboxEntry{key: o.key(e), event: e, body: body}
+	if err := o.objStore.PutObject(ctx, o.bucket, entry.key, bytes.NewReader(body), int64(len(body)), "application/json"); err != nil {
+		// The event is still published, unless the service stops first
+		logging.FromContext(ctx).Error("writing event to outbox", "event_id", e.ID, "error", err)
+		entry.key = ""
+	}
+	select {
+	case o.queue <- entry:
+	default:
+		o.postpone(ctx, entry)
+	}
+}
+
+// postpone leaves an event in the bucket, to be loaded once the pending
+// events are published. Events that could not be written are dropped.
+func (o *Outbox) postpone(ctx context.Context, entry outboxEntry) {
+	if entry.key == "" {
+		logging.FromContext(ctx).Error("too many events waiting, dropping event", "event_id", entry.event.ID)
+		metrics.AddBrokerEvent("dropped")
+		return
+	}
+	o.overflow.Store(true)
+}
+
+// Run writes the queued events to the outbox and publishes them until ctx
+// is done. While the broker fails, publishing is retried every
+// RetryInterval.
+func (o *Outbox) Run(ctx context.Context) {
+	defer o.publisher.Close()
+
+	var retry <-chan time.Time
+	flush := func() {
+		retry = nil
+		if !o.flush(ctx) {
+			retry = time.After(o.settings.RetryInterval)
+		}
+	}
+	flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry := <-o.queue:
+			o.add(ctx, entry)
+			if retry == nil {
+				flush()
+			}
+		case <-retry:
+			flush()
+		}
+	}
+}
+
+// add appends a written event to pending. Once events were left in the
+// bucket, later ones are left there as well, so they stay in order.
+func (o *Outbox) add(ctx context.Context, entry outboxEntry) {
+	if o.overflow.Load() || len(o.pending) >= maxPending {
+		o.postpone(ctx, entry)
+		return
+	}
+	o.pending = append(o.pending, entry)
+	metrics.SetBrokerOutbox(len(o.pending))
+}
+
+// flush publishes the pending events in order, loading those left in the
+// bucket once the others are published. It returns false if the broker or
+// loading failed.
+func (o *Outbox) flush(ctx context.Context) bool {
+	for {
+		if len(o.pending) == 0 {
+			if !o.overflow.Swap(false) {
+				return true
+			}
+			if err := o.load(ctx); err != nil {
+				logging.FromContext(ctx).Error("loading events from outbox", "error", err)
+				o.overflow.Store(true)
+				return false
+			}
+			continue
+		}
+		entry := o.pending[0]
+		var topic strings.Builder
+		if err := o.topic.Execute(&topic, entry.event); err != nil {
+			// Checked by NewOutbox, so this should not happen
+			logging.FromContext(ctx).Error("executing broker topic", "event_id", entry.event.ID, "error", err)
+			metrics.AddBrokerEvent("dropped")
+			o.remove(ctx, entry)
+			continue
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, o.settings.Timeout)
+		err := o.publisher.Publish(publishCtx, topic.String(), entry.event.ID, entry.body)
+		cancel()
+		if err != nil {
+			logging.FromContext(ctx).Warn("publishing event", "event_id", entry.event.ID,
+				"pending", len(o.pending), "error", err)
+			metrics.AddBrokerEvent("failed")
+			return false
+		}
+		metrics.AddBrokerEvent("published")
+		o.remove(ctx, entry)
+	}
+}
+
+// remove deletes the first pending entry. If deleting it from the bucket
+// fails, it is published again after a restart.
+func (o *Outbox) remove(ctx context.Context, entry outboxEntry) {
+	o.pending = o.pending[1:]
+	metrics.SetBrokerOutbox(len(o.pending))
+	if entry.key == "" {
+		return
+	}
+	if err := o.objStore.DeleteObject(ctx, o.bucket, entry.key); err != nil {
+		logging.FromContext(ctx).Error("deleting event from outbox", "event_id", entry.event.ID, "error", err)
+	}
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// watchInterval is how often the config file is checked for changes.
+const watchInterval = 2 * time.Second
+
+// Value holds settings that may change on reload. It is safe for
+// concurrent use.
+type Value[T any] struct {
+	p atomic.Pointer[T]
+}
+
+func NewValue[T any](v T) *Value[T] {
+	value := &Value[T]{}
+	value.Store(v)
+	return value
+}
+
+func (v *Value[T]) Load() T {
+	return *v.p.Load()
+}
+
+func (v *Value[T]) Store(t T) {
+	v.p.Store(&t)
+}
+
+var (
+	reloadMu       sync.Mutex
+	reloadHandlers = make(map[int]func(c *Config))
+	nextHandlerID  int
+)
+
+// OnReload registers a function that applies a reloaded config, until the
+// returned function is called.
+func OnReload(handler func(c *Config)) (unsubscribe func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	id := nextHandlerID
+	nextHandlerID++
+	reloadHandlers[id] = handler
+	return func() {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		delete(reloadHandlers, id)
+	}
+}
+
+// Reload loads the config again. An invalid config is rejected and the
+// current one kept. Of a valid config only the settings that can change at
+// runtime are applied: logging, upload limits, CORS origins, download URL
+// validity and credentials. Other changes take effect after a restart.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	c, err := Load()
+	if err != nil {
+		return err
+	}
+	applied := *GlobalConfig
+	applied.Log = c.Log
+	applied.Upload = c.Upload
+	applied.CORS = c.CORS
+	applied.Storage.PresignTTL = c.Storage.PresignTTL
+	applied.Storage.Credentials = c.Storage.Credentials
+	for _, name := range changedFields(applied, *c) {
+		log.Printf("Config setting '%s' changed, restart to apply it", name)
+	}
+
+	GlobalConfig = &applied
+	for _, handler := range reloadHandlers {
+		handler(&applied)
+	}
+	log.Println("Config reloaded")
+	return nil
+}
+
+// changedFields lists the names of the top-level fields that differ.
+func changedFields(a Config, b Config) []string {
+	var names []string
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			names = append(names, va.Type().Field(i).Name)
+		}
+	}
+	return names
+}
+
+// Watch reloads the config on SIGHUP and whenever the config file changes,
+// until ctx is done.
+func Watch(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := fileVersion()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Println("Received SIGHUP, reloading config")
+		case <-ticker.C:
+			version := fileVersion()
+			if version == last {
+				continue
+			}
+			last = version
+			log.Println("Config file changed, reloading config")
+		}
+		if err := Reload(); err != nil {
+			log.Println("Rejected config reload, keeping the current config:\n" + err.Error())
+		}
+	}
+}
+
+// fileVersion identifies the current contents of the config file, also if
+// it is replaced through a symlink as in Kubernetes config maps.
+func fileVersion() string {
+	path, _, err := configPath()
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return info.ModTime().String() + "/" + strconv.FormatInt(info.Size(), 10)
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zpatrick/go-config"
+)
+
+// envPrefix starts the environment variables that override settings, e.g.
+// SOGNO_FILE_SERVICE_MINIO_ENDPOINT for "minio_endpoint" and
+// SOGNO_FILE_SERVICE_LOG__LEVEL for "log.level".
+const envPrefix = "SOGNO_FILE_SERVICE_"
+
+// envConfigPath selects the config file if the -config flag is not given.
+const envConfigPath = envPrefix + "CONFIG"
+
+var (
+	configPathFlag = flag.String("config", "",
+		"path of the config file (.json, .yaml, .yml or .toml), overrides $"+envConfigPath)
+	settingFlags settingsFlag
+)
+
+func init() {
+	flag.Var(&settingFlags, "set", "override a setting, e.g. -set log.level=debug (repeatable)")
+}
+
+// settingsFlag collects the key=value pairs of repeated -set flags.
+type settingsFlag map[string]string
+
+func (f *settingsFlag) String() string {
+	var pairs []string
+	for key, value := range *f {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *settingsFlag) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got '%s'", pair)
+	}
+	if *f == nil {
+		*f = make(settingsFlag)
+	}
+	(*f)[key] = value
+	return nil
+}
+
+func (f *settingsFlag) Load() (map[string]string, error) {
+	settings := make(map[string]string)
+	for key, value := range *f {
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+// configPath returns the path of the config file and whether it was chosen
+// explicitly. The default file in the user config directory is optional.
+func configPath() (string, bool, error) {
+	if *configPathFlag != "" {
+		return *configPathFlag, true, nil
+	}
+	if path, ok := os.LookupEnv(envConfigPath); ok {
+		return path, true, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false, err
+	}
+	return filepath.Join(configDir, "sogno-file-service/config.json"), false, nil
+}
+
+// fileProvider reads the config file in the format given by its extension.
+// Without a path, no file is read.
+type fileProvider struct {
+	path     string
+	required bool
+}
+
+func (p fileProvider) Load() (map[string]string, error) {
+	if p.path == "" {
+		return map[string]string{}, nil
+	}
+	if _, err := os.Stat(p.path); errors.Is(err, fs.ErrNotExist) && !p.required {
+		return map[string]string{}, nil
+	}
+	var provider config.Provider
+	switch strings.ToLower(filepath.Ext(p.path)) {
+	case ".json":
+		provider = config.NewJSONFile(p.path)
+	case ".yaml", ".yml":
+		provider = config.NewYAMLFile(p.path)
+	case ".toml":
+		provider = config.NewTOMLFile(p.path)
+	default:
+		return nil, fmt.Errorf("unknown format of config file '%s'", p.path)
+	}
+	settings, err := provider.Load()
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s': %w", p.path, err)
+	}
+	return settings, nil
+}
+
+// environmentProvider reads the settings from all environment variables
+// starting with envPrefix. Double underscores separate nested keys. Empty
+// variables reset settings to their defaults.
+type environmentProvider struct{}
+
+func (environmentProvider) Load() (map[string]string, error) {
+	settings := make(map[string]string)
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, envPrefix) || name == envConfigPath {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(name, envPrefix))
+		settings[strings.ReplaceAll(key, "__", ".")] = value
+	}
+	return settings, nil
+}
+
+// sources returns the providers of all settings, later ones overriding
+// earlier ones: config file, environment variables and -set flags.
+// Defaults apply to settings that none of them sets. Flags are only
+// taken into account once the program has parsed them.
+func sources() ([]config.Provider, string, error) {
+	path, required, err := configPath()
+	if err != nil {
+		return nil, "", err
+	}
+	return []config.Provider{
+		fileProvider{path: path, required: required},
+		environmentProvider{},
+		&settingFlags,
+	}, path, nil
+}
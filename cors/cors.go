@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cors
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sogno-platform/file-service/config"
+)
+
+// preflightMaxAge is how long browsers may cache a preflight response, in
+// seconds.
+const preflightMaxAge = "600"
+
+var (
+	allowedMethods = strings.Join([]string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions,
+	}, ", ")
+	exposedHeaders = strings.Join([]string{
+		"X-Request-ID", "Retry-After", "Content-Disposition",
+	}, ", ")
+)
+
+// Middleware lets browsers call the API from the configured origins. It
+// answers preflight requests itself, so it must be installed with Use on
+// the engine to also see requests for which no OPTIONS route exists.
+func Middleware(settings *config.Value[config.CORSSettings]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		allowed, wildcard := allowedOrigin(settings.Load().Origins, origin)
+		if !allowed {
+			c.Next()
+			return
+		}
+
+		if wildcard {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		c.Header("Access-Control-Expose-Headers", exposedHeaders)
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", allowedMethods)
+			if headers := c.GetHeader("Access-Control-Request-Headers"); headers != "" {
+				c.Header("Access-Control-Allow-Headers", headers)
+			}
+			c.Header("Access-Control-Max-Age", preflightMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowedOrigin tells whether origin may call the API and whether that is
+// because any origin may.
+func allowedOrigin(origins []string, origin string) (allowed bool, wildcard bool) {
+	for _, o := range origins {
+		if o == "*" {
+			return true, true
+		}
+		if strings.EqualFold(o, origin) {
+			return true, false
+		}
+	}
+	return false, false
+}
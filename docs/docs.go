@@ -16,57 +16,86 @@ const docTemplate_swagger = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/files": {
+        "/collections": {
             "get": {
+                "description": "Lists the collections and files directly inside a collection,\nnested collections are not descended into.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "collections"
+                ],
+                "summary": "List the contents of a collection",
+                "operationId": "GetCollectionContents",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of collection to list, omit for the top level",
+                        "name": "parentID",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get all files on the server",
-                "operationId": "GetFiles",
                 "responses": {
                     "200": {
-                        "description": "Files available",
+                        "description": "Contents of collection",
                         "schema": {
-                            "$ref": "#/definitions/api.ResponseFiles"
+                            "$ref": "#/definitions/api.ResponseCollectionContents"
+                        }
+                    },
+                    "404": {
+                        "description": "Collection not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/api.ResponseFiles"
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
                         }
                     }
                 }
             },
             "post": {
                 "consumes": [
-                    "multipart/form-data"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "collections"
                 ],
-                "summary": "Add file",
-                "operationId": "AddFile",
+                "summary": "Add collection",
+                "operationId": "AddCollection",
                 "parameters": [
                     {
-                        "type": "file",
-                        "description": "File to be uploaded",
-                        "name": "file",
-                        "in": "formData",
-                        "required": true
+                        "description": "Collection to be added",
+                        "name": "collection",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestCollection"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "File that was added",
+                        "description": "Collection that was added",
                         "schema": {
-                            "$ref": "#/definitions/api.ResponseFile"
+                            "$ref": "#/definitions/api.ResponseCollection"
                         }
                     },
                     "400": {
@@ -75,55 +104,67 @@ const docTemplate_swagger = `{
                             "$ref": "#/definitions/api.ResponseError"
                         }
                     },
+                    "404": {
+                        "description": "Parent collection not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "409": {
+                        "description": "A sibling with the same name exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/api.ResponseError"
                         }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
                     }
                 }
             }
         },
-        "/files/{fileID}": {
+        "/collections/{collectionID}": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "collections"
                 ],
-                "summary": "Get file info",
-                "operationId": "GetFile",
+                "summary": "Get collection info",
+                "operationId": "GetCollection",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID of file",
-                        "name": "fileID",
+                        "description": "ID of collection",
+                        "name": "collectionID",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "File info",
+                        "description": "Collection info",
                         "schema": {
-                            "$ref": "#/definitions/api.ResponseFile"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad request",
-                        "schema": {
-                            "$ref": "#/definitions/api.ResponseError"
+                            "$ref": "#/definitions/api.ResponseCollection"
                         }
                     },
                     "404": {
-                        "description": "File not found",
-                        "schema": {
-                            "$ref": "#/definitions/api.ResponseError"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal server error",
+                        "description": "Collection not found",
                         "schema": {
                             "$ref": "#/definitions/api.ResponseError"
                         }
@@ -131,38 +172,41 @@ const docTemplate_swagger = `{
                 }
             },
             "put": {
+                "description": "Files and collections inside the collection move along with it. Omit parentID to keep\nthe current parent.",
                 "consumes": [
-                    "multipart/form-data"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "collections"
                 ],
-                "summary": "Update file",
-                "operationId": "UpdateFile",
+                "summary": "Rename or move collection",
+                "operationId": "UpdateCollection",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID of file",
-                        "name": "fileID",
+                        "description": "ID of collection",
+                        "name": "collectionID",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "type": "file",
-                        "description": "File to be uploaded",
-                        "name": "file",
-                        "in": "formData",
-                        "required": true
+                        "description": "New name and parent of collection",
+                        "name": "collection",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestCollection"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "File that was updated",
+                        "description": "Collection that was updated",
                         "schema": {
-                            "$ref": "#/definitions/api.ResponseFile"
+                            "$ref": "#/definitions/api.ResponseCollection"
                         }
                     },
                     "400": {
@@ -172,7 +216,13 @@ const docTemplate_swagger = `{
                         }
                     },
                     "404": {
-                        "description": "File not found",
+                        "description": "Collection not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "409": {
+                        "description": "Name taken or move into itself",
                         "schema": {
                             "$ref": "#/definitions/api.ResponseError"
                         }
@@ -182,6 +232,18 @@ const docTemplate_swagger = `{
                         "schema": {
                             "$ref": "#/definitions/api.ResponseError"
                         }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
                     }
                 }
             },
@@ -190,123 +252,2146 @@ const docTemplate_swagger = `{
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "collections"
                 ],
-                "summary": "Delete file",
-                "operationId": "DeleteFile",
+                "summary": "Delete empty collection",
+                "operationId": "DeleteCollection",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID of file",
-                        "name": "fileID",
+                        "description": "ID of collection",
+                        "name": "collectionID",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Succeeds whether the file exists or not",
+                        "description": "Collection was deleted",
                         "schema": {
                             "$ref": "#/definitions/api.ResponseEmpty"
                         }
                     },
+                    "404": {
+                        "description": "Collection not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "409": {
+                        "description": "Collection is not empty",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/api.ResponseError"
                         }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "api.ResponseEmpty": {
-            "description": "Empty successful response",
-            "type": "object",
-            "required": [
-                "data"
-            ],
-            "properties": {
-                "data": {
-                    "type": "object"
-                }
-            }
-        },
-        "api.ResponseError": {
-            "description": "An error",
-            "type": "object",
-            "required": [
-                "error"
-            ],
-            "properties": {
-                "error": {
-                    "$ref": "#/definitions/api.ResponseErrorData"
-                }
-            }
-        },
-        "api.ResponseErrorData": {
-            "type": "object",
-            "required": [
-                "code",
-                "message"
-            ],
-            "properties": {
-                "code": {
-                    "description": "HTTP response status code",
-                    "type": "integer"
-                },
-                "message": {
-                    "description": "Description of the error",
-                    "type": "string"
-                }
-            }
-        },
-        "api.ResponseFile": {
-            "description": "A single file",
-            "type": "object",
-            "required": [
-                "data"
-            ],
-            "properties": {
-                "data": {
-                    "$ref": "#/definitions/api.ResponseFileData"
-                }
-            }
-        },
-        "api.ResponseFileData": {
-            "type": "object",
-            "required": [
-                "fileID",
-                "lastModified"
-            ],
-            "properties": {
-                "fileID": {
-                    "description": "ID of file",
-                    "type": "string"
-                },
-                "lastModified": {
-                    "description": "Last modified timestamp of file",
-                    "type": "string"
-                },
-                "url": {
-                    "description": "URL of file",
-                    "type": "string"
-                }
-            }
         },
-        "api.ResponseFiles": {
-            "description": "Multiple files (NOTE: Partial responses are possible. In this case ` + "`" + `data` + "`" + ` and ` + "`" + `error` + "`" + ` will be returned.)",
-            "type": "object",
-            "properties": {
-                "data": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/api.ResponseFileData"
+        "/files": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get all files on the server",
+                "operationId": "GetFiles",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only list files directly inside this collection",
+                        "name": "collectionID",
+                        "in": "query"
                     }
-                },
-                "error": {
-                    "$ref": "#/definitions/api.ResponseErrorData"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Files available",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFiles"
+                        }
+                    },
+                    "404": {
+                        "description": "Collection not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFiles"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "With extract, the files of an uploaded archive are added to a new collection below\ncollectionID. It is called collectionName, or named after the archive and numbered if that\nname is taken, as in \"models (2)\". Entries outside of the archive are rejected, as are\narchives that extract to more files or bytes than the upload.extract limits allow.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Add file",
+                "operationId": "AddFile",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "File to be uploaded",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of collection to place the file in",
+                        "name": "collectionID",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tags of the file as comma-separated key=value pairs",
+                        "name": "tags",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time at which the file expires (RFC 3339)",
+                        "name": "expiresAt",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time to live of the file, e.g. 72h, instead of expiresAt",
+                        "name": "ttl",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Extract the uploaded ZIP, tar or tar.gz archive into a new collection, responding with api.ResponseExtract",
+                        "name": "extract",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Keep the archive itself as well when extracting it",
+                        "name": "keepArchive",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the collection to extract the archive into",
+                        "name": "collectionName",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File that was added",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "409": {
+                        "description": "A collection named collectionName exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "413": {
+                        "description": "Upload or extracted archive too large",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/bulk": {
+            "post": {
+                "description": "Applies an operation to the files given by ID or matching a filter and returns the\nresult for each file. Send \"Accept: application/x-ndjson\" to receive the results\nas a stream of JSON lines while the operation progresses.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Delete, tag, move or expire many files",
+                "operationId": "BulkFiles",
+                "parameters": [
+                    {
+                        "description": "Operation and the files to apply it to",
+                        "name": "operation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestBulk"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Result by file",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseBulk"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Collection not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/download": {
+            "post": {
+                "description": "Streams a ZIP or gzipped tar archive of the files given by ID or matching a filter.\nFiles are named by their collections and original name. If the object store fails\nwhile the archive is streamed, the archive ends incomplete.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/zip",
+                    "application/gzip"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Download many files as one archive",
+                "operationId": "DownloadFiles",
+                "parameters": [
+                    {
+                        "description": "Files to download and archive format",
+                        "name": "files",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestDownload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Archive of the files",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File or collection not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/events": {
+            "get": {
+                "description": "Streams the events of the files as server-sent events (text/event-stream) until the\nclient hangs up. Each message holds an event as JSON with its ID as the message ID.\nClients resuming with the Last-Event-ID header (or lastEventID parameter) first get\nthe events they missed. If those are no longer known, a \"reset\" event is sent first\nand the client should reload the files.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Stream the events of files",
+                "operationId": "GetFileEvents",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Only stream events of these types",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only stream events of files whose path starts with this prefix",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only stream events of files with this tag, given as key=value",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the last event received, for clients unable to set headers",
+                        "name": "lastEventID",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the last event received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stream of events",
+                        "schema": {
+                            "$ref": "#/definitions/events.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{fileID}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get file info",
+                "operationId": "GetFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File info",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "410": {
+                        "description": "File expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Update file",
+                "operationId": "UpdateFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "File to be uploaded",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of collection to move the file to, empty for the top level",
+                        "name": "collectionID",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tags replacing those of the file as comma-separated key=value pairs",
+                        "name": "tags",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time at which the file expires (RFC 3339), empty to keep it",
+                        "name": "expiresAt",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time to live of the file, e.g. 72h, instead of expiresAt",
+                        "name": "ttl",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File that was updated",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "410": {
+                        "description": "File expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "413": {
+                        "description": "Upload too large",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Moves the file to the trash if the service keeps deleted files, otherwise deletes it permanently.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Delete file",
+                "operationId": "DeleteFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File was deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseEmpty"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{fileID}/archive": {
+            "get": {
+                "description": "Lists the files inside a stored ZIP, tar or gzipped tar archive without extracting it.\nOf ZIP archives only the central directory is read.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "List the files inside an archive",
+                "operationId": "GetArchiveEntries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Files inside the archive",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseArchiveEntries"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID or file is no archive",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "410": {
+                        "description": "File expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{fileID}/archive/{path}": {
+            "get": {
+                "description": "Streams a single file inside a stored ZIP, tar or gzipped tar archive. Of ZIP archives\nonly the central directory and the file itself are read.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Download a file inside an archive",
+                "operationId": "GetArchiveEntry",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path of the file inside the archive",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Content of the file",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID or file is no archive",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found or not in the archive",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "410": {
+                        "description": "File expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{fileID}/copy": {
+            "post": {
+                "description": "Copies a file on the object store to a new file ID, optionally into another project,\nwithout moving its content through the client. Name and tags are copied unless given.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Copy file",
+                "operationId": "CopyFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Where to copy the file to and metadata of the copy",
+                        "name": "target",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestCopyFile"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Copy of the file",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File or project not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "410": {
+                        "description": "File expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{fileID}/expiry": {
+            "put": {
+                "description": "Expiry rules of the service still apply to files without an expiry of their own.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Set or clear the expiry of a file",
+                "operationId": "SetExpiry",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New expiry of the file",
+                        "name": "expiry",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestExpiry"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File with its new expiry",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "410": {
+                        "description": "File expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{fileID}/move": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Move file to another collection",
+                "operationId": "MoveFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Collection to move the file to",
+                        "name": "target",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestMoveFile"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File that was moved",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "410": {
+                        "description": "File expired",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects": {
+            "get": {
+                "description": "Each project has its own namespace of files and collections.\nThe endpoints below /files and /collections are available for a\nsingle project below /projects/{projectID}/files and\n/projects/{projectID}/collections.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Get all projects",
+                "operationId": "GetProjects",
+                "responses": {
+                    "200": {
+                        "description": "Projects available",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseProjects"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{projectID}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Get project info",
+                "operationId": "GetProject",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of project",
+                        "name": "projectID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Project info",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseProject"
+                        }
+                    },
+                    "404": {
+                        "description": "Project not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/trash": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trash"
+                ],
+                "summary": "List the files in the trash",
+                "operationId": "GetTrash",
+                "responses": {
+                    "200": {
+                        "description": "Files in the trash, most recently deleted first",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFiles"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trash"
+                ],
+                "summary": "Delete all files in the trash permanently",
+                "operationId": "EmptyTrash",
+                "responses": {
+                    "200": {
+                        "description": "Trash was emptied",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseEmpty"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/trash/{fileID}": {
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trash"
+                ],
+                "summary": "Delete a file in the trash permanently",
+                "operationId": "PurgeFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File was purged",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseEmpty"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not in trash",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/trash/{fileID}/restore": {
+            "post": {
+                "description": "Files whose collection has been deleted are restored to the top level.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trash"
+                ],
+                "summary": "Restore a file from the trash",
+                "operationId": "RestoreFile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of file",
+                        "name": "fileID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File that was restored",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "404": {
+                        "description": "File not in trash",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get all webhooks",
+                "operationId": "GetWebhooks",
+                "responses": {
+                    "200": {
+                        "description": "Webhooks, oldest first",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseWebhooks"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Events are posted as JSON to the URL, signed with the secret of the webhook in the\nX-Sogno-Signature header. Failed deliveries are retried with backoff. The secret is\nonly returned here. URLs of hosts in the denied networks of the webhooks settings, by\ndefault loopback, link-local and private ones, are rejected.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Subscribe to the events of files",
+                "operationId": "AddWebhook",
+                "parameters": [
+                    {
+                        "description": "URL and filter of webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.RequestWebhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Webhook that was added, with its secret",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseWebhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request, or a webhook URL in a denied network",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookID}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get webhook",
+                "operationId": "GetWebhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of webhook",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Webhook",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseWebhook"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Pending deliveries are dropped.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete webhook",
+                "operationId": "DeleteWebhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of webhook",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Webhook was deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseEmpty"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "503": {
+                        "description": "Object store is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    },
+                    "504": {
+                        "description": "Object store timed out",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookID}/deliveries": {
+            "get": {
+                "description": "The log is kept in memory and holds the latest deliveries up to webhooks.log_size.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get the latest deliveries of a webhook",
+                "operationId": "GetDeliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of webhook",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Deliveries, most recent first",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseDeliveries"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseError"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.RequestBulk": {
+            "description": "Operation on many files, selected by ID or by a filter",
+            "type": "object",
+            "required": [
+                "operation"
+            ],
+            "properties": {
+                "collectionID": {
+                    "description": "ID of target collection for \"move\", empty for the top level",
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "Time at which the files expire for \"expire\" (RFC 3339)",
+                    "type": "string"
+                },
+                "fileIDs": {
+                    "description": "IDs of the files, instead of a filter",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "filter": {
+                    "description": "Selects the files if no IDs are given",
+                    "$ref": "#/definitions/api.RequestBulkFilter"
+                },
+                "operation": {
+                    "description": "\"delete\", \"tag\", \"move\" or \"expire\"",
+                    "type": "string"
+                },
+                "removeTags": {
+                    "description": "Keys of the tags to remove for \"tag\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tags": {
+                    "description": "Tags to set for \"tag\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "ttl": {
+                    "description": "Time to live from now for \"expire\", instead of expiresAt; both empty\nto keep the files",
+                    "type": "string"
+                }
+            }
+        },
+        "api.RequestBulkFilter": {
+            "description": "Files matching all the given conditions",
+            "type": "object",
+            "properties": {
+                "collectionID": {
+                    "description": "Only files directly inside this collection, empty for the top level",
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Only files whose path (collections and name) starts with this prefix",
+                    "type": "string"
+                },
+                "tag": {
+                    "description": "Only files with this tag, given as key=value",
+                    "type": "string"
+                }
+            }
+        },
+        "api.RequestCollection": {
+            "description": "Collection to be created or updated",
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "description": "Name of collection (must not contain slashes)",
+                    "type": "string"
+                },
+                "parentID": {
+                    "description": "ID of parent collection, empty for the top level. Updates that omit it\nkeep the current parent.",
+                    "type": "string"
+                }
+            }
+        },
+        "api.RequestCopyFile": {
+            "description": "Target of a file copy. Omitted fields are taken from the original file.",
+            "type": "object",
+            "properties": {
+                "collectionID": {
+                    "description": "ID of collection to place the copy in, empty for the top level. By\ndefault the copy is placed next to the original, or at the top level of\nanother project.",
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "Time at which the copy expires (RFC 3339), by default it is kept",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name of the copy",
+                    "type": "string"
+                },
+                "projectID": {
+                    "description": "ID of project to copy the file to, empty for the same project",
+                    "type": "string"
+                },
+                "tags": {
+                    "description": "Tags of the copy",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "ttl": {
+                    "description": "Time to live of the copy, instead of expiresAt",
+                    "type": "string"
+                }
+            }
+        },
+        "api.RequestDownload": {
+            "description": "Files to download as one archive, selected by ID or by a filter",
+            "type": "object",
+            "properties": {
+                "fileIDs": {
+                    "description": "IDs of the files, instead of a filter",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "filter": {
+                    "description": "Selects the files if no IDs are given",
+                    "$ref": "#/definitions/api.RequestBulkFilter"
+                },
+                "format": {
+                    "description": "Archive format: \"zip\" (default) or \"tar.gz\"",
+                    "type": "string"
+                }
+            }
+        },
+        "api.RequestExpiry": {
+            "description": "Expiry of a file, both empty to keep the file",
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "description": "Time at which the file expires (RFC 3339)",
+                    "type": "string"
+                },
+                "ttl": {
+                    "description": "Time to live from now, e.g. \"72h\", instead of expiresAt",
+                    "type": "string"
+                }
+            }
+        },
+        "api.RequestMoveFile": {
+            "description": "Target of a file move",
+            "type": "object",
+            "properties": {
+                "collectionID": {
+                    "description": "ID of target collection, empty for the top level",
+                    "type": "string"
+                }
+            }
+        },
+        "api.RequestWebhook": {
+            "description": "Subscription to the events of files",
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "events": {
+                    "description": "Types of events to send, all if empty: file.created, file.updated,\nfile.deleted and file.metadata_changed",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "prefix": {
+                    "description": "Only events of files whose path (collections and name) starts with\nthis prefix",
+                    "type": "string"
+                },
+                "projectID": {
+                    "description": "Only events of files in this project, \"\" for those outside of projects",
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Secret to sign the events with, generated if empty",
+                    "type": "string"
+                },
+                "tag": {
+                    "description": "Only events of files with this tag, given as key=value",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "URL the events are posted to, http or https",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseArchiveEntries": {
+            "description": "Files inside an archive",
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseArchiveEntryData"
+                    }
+                }
+            }
+        },
+        "api.ResponseArchiveEntryData": {
+            "type": "object",
+            "required": [
+                "path"
+            ],
+            "properties": {
+                "lastModified": {
+                    "description": "Last modified timestamp of the entry",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path of the entry inside the archive",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "Size of the entry in bytes, uncompressed",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.ResponseBulk": {
+            "description": "Results of a bulk operation by file. With \"Accept: application/x-ndjson\" each result is streamed as a line instead.",
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseBulkResult"
+                    }
+                }
+            }
+        },
+        "api.ResponseBulkResult": {
+            "type": "object",
+            "required": [
+                "code",
+                "fileID"
+            ],
+            "properties": {
+                "code": {
+                    "description": "HTTP status code of the operation on this file",
+                    "type": "integer"
+                },
+                "error": {
+                    "description": "Why the operation failed on this file",
+                    "$ref": "#/definitions/api.ResponseErrorData"
+                },
+                "fileID": {
+                    "description": "ID of file",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseCollection": {
+            "description": "A single collection",
+            "type": "object",
+            "required": [
+                "data"
+            ],
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/api.ResponseCollectionData"
+                }
+            }
+        },
+        "api.ResponseCollectionContents": {
+            "description": "Contents of a collection (not recursive)",
+            "type": "object",
+            "required": [
+                "data"
+            ],
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/api.ResponseCollectionContentsData"
+                }
+            }
+        },
+        "api.ResponseCollectionContentsData": {
+            "type": "object",
+            "properties": {
+                "collections": {
+                    "description": "Collections directly inside the listed collection",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseCollectionData"
+                    }
+                },
+                "files": {
+                    "description": "Files directly inside the listed collection",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseFileData"
+                    }
+                }
+            }
+        },
+        "api.ResponseCollectionData": {
+            "type": "object",
+            "required": [
+                "collectionID",
+                "createdAt",
+                "name",
+                "path"
+            ],
+            "properties": {
+                "collectionID": {
+                    "description": "ID of collection",
+                    "type": "string"
+                },
+                "createdAt": {
+                    "description": "Creation timestamp of collection",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name of collection",
+                    "type": "string"
+                },
+                "parentID": {
+                    "description": "ID of parent collection, omitted for top-level collections",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Names of all collections from the top level down to this one,\nseparated by slashes",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseDeliveries": {
+            "description": "Latest deliveries of a webhook, most recent first",
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseDeliveryData"
+                    }
+                }
+            }
+        },
+        "api.ResponseDeliveryData": {
+            "type": "object",
+            "required": [
+                "createdAt",
+                "deliveryID",
+                "eventID",
+                "eventType",
+                "status",
+                "updatedAt"
+            ],
+            "properties": {
+                "attempts": {
+                    "description": "Number of attempts so far",
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "deliveryID": {
+                    "description": "ID of delivery, sent as X-Sogno-Delivery",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Why the last attempt failed",
+                    "type": "string"
+                },
+                "eventID": {
+                    "type": "string"
+                },
+                "eventType": {
+                    "type": "string"
+                },
+                "fileID": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "\"pending\" while attempts are left, \"delivered\" or \"failed\"",
+                    "type": "string"
+                },
+                "statusCode": {
+                    "description": "HTTP status code of the last attempt, if it got a response",
+                    "type": "integer"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseEmpty": {
+            "description": "Empty successful response",
+            "type": "object",
+            "required": [
+                "data"
+            ],
+            "properties": {
+                "data": {
+                    "type": "object"
+                }
+            }
+        },
+        "api.ResponseError": {
+            "description": "An error",
+            "type": "object",
+            "required": [
+                "error"
+            ],
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/api.ResponseErrorData"
+                }
+            }
+        },
+        "api.ResponseErrorData": {
+            "type": "object",
+            "required": [
+                "code",
+                "errorCode",
+                "message"
+            ],
+            "properties": {
+                "code": {
+                    "description": "HTTP response status code",
+                    "type": "integer"
+                },
+                "details": {
+                    "description": "Further information depending on the error code",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "errorCode": {
+                    "description": "Stable code of the error, e.g. \"file_not_found\"",
+                    "type": "string"
+                },
+                "message": {
+                    "description": "Description of the error",
+                    "type": "string"
+                },
+                "requestID": {
+                    "description": "ID of the request, to be quoted in bug reports",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseFile": {
+            "description": "A single file",
+            "type": "object",
+            "required": [
+                "data"
+            ],
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/api.ResponseFileData"
+                }
+            }
+        },
+        "api.ResponseFileData": {
+            "type": "object",
+            "required": [
+                "fileID",
+                "lastModified"
+            ],
+            "properties": {
+                "collectionID": {
+                    "description": "ID of collection the file is placed in, omitted for the top level",
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "description": "Time at which the file was moved to the trash",
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "Time at which the file expires, omitted if it is kept",
+                    "type": "string"
+                },
+                "fileID": {
+                    "description": "ID of file",
+                    "type": "string"
+                },
+                "lastModified": {
+                    "description": "Last modified timestamp of file",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Original name of file",
+                    "type": "string"
+                },
+                "purgeAt": {
+                    "description": "Time at which the file is purged from the trash",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "Size of file in bytes",
+                    "type": "integer"
+                },
+                "tags": {
+                    "description": "Tags of file",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "description": "URL of file",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseFiles": {
+            "description": "Multiple files (NOTE: Partial responses are possible. In this case ` + "`" + `data` + "`" + ` and ` + "`" + `error` + "`" + ` will be returned.)",
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseFileData"
+                    }
+                },
+                "error": {
+                    "$ref": "#/definitions/api.ResponseErrorData"
+                }
+            }
+        },
+        "api.ResponseProject": {
+            "description": "A single project",
+            "type": "object",
+            "required": [
+                "data"
+            ],
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/api.ResponseProjectData"
+                }
+            }
+        },
+        "api.ResponseProjectData": {
+            "type": "object",
+            "required": [
+                "name",
+                "projectID"
+            ],
+            "properties": {
+                "name": {
+                    "description": "Display name of project",
+                    "type": "string"
+                },
+                "projectID": {
+                    "description": "ID of project",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseProjects": {
+            "description": "Multiple projects",
+            "type": "object",
+            "required": [
+                "data"
+            ],
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseProjectData"
+                    }
+                }
+            }
+        },
+        "api.ResponseWebhook": {
+            "description": "A single webhook",
+            "type": "object",
+            "required": [
+                "data"
+            ],
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/api.ResponseWebhookData"
+                }
+            }
+        },
+        "api.ResponseWebhookData": {
+            "type": "object",
+            "required": [
+                "createdAt",
+                "url",
+                "webhookID"
+            ],
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "events": {
+                    "description": "Types of events sent, all if empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "prefix": {
+                    "description": "Only events of files whose path starts with this prefix",
+                    "type": "string"
+                },
+                "projectID": {
+                    "description": "Only events of files in this project, \"\" for those outside of\nprojects",
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Secret the events are signed with, only returned when the webhook is\ncreated",
+                    "type": "string"
+                },
+                "tag": {
+                    "description": "Only events of files with this tag, as key=value",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "URL the events are posted to",
+                    "type": "string"
+                },
+                "webhookID": {
+                    "description": "ID of webhook",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseWebhooks": {
+            "description": "Multiple webhooks",
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseWebhookData"
+                    }
+                }
+            }
+        },
+        "events.Event": {
+            "type": "object",
+            "properties": {
+                "collectionID": {
+                    "type": "string"
+                },
+                "fileID": {
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Unique ID of the event",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path of the file made of its collections and name",
+                    "type": "string"
+                },
+                "projectID": {
+                    "description": "Project of the file, empty for the files outside of projects",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "Size of the file in bytes, 0 for deleted files",
+                    "type": "integer"
+                },
+                "tags": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "time": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
                 }
             }
         }
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package events passes the lifecycle events of files from the file
+// controllers to those notifying other services.
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of events. They are part of the API and must not change.
+const (
+	FileCreated = "file.created"
+	// The content of the file was replaced
+	FileUpdated = "file.updated"
+	// The file was deleted or moved to the trash
+	FileDeleted = "file.deleted"
+	// The name, collection, tags or expiry of the file changed
+	FileMetadataChanged = "file.metadata_changed"
+)
+
+// Types are all types of events.
+var Types = []string{FileCreated, FileUpdated, FileDeleted, FileMetadataChanged}
+
+type Event struct {
+	// Unique ID of the event
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Project of the file, empty for the files outside of projects
+	ProjectID string `json:"projectID,omitempty"`
+	FileID    string `json:"fileID"`
+	// Path of the file made of its collections and name
+	Path         string            `json:"path"`
+	Name         string            `json:"name,omitempty"`
+	CollectionID string            `json:"collectionID,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	// Size of the file in bytes, 0 for deleted files
+	Size int64 `json:"size,omitempty"`
+}
+
+// New returns an event of the given type that happened now.
+func New(eventType string) Event {
+	return Event{ID: uuid.New().String(), Type: eventType, Time: time.Now().UTC()}
+}
+
+// Filter selects events. Empty fields match all events.
+type Filter struct {
+	Types     []string `json:"types,omitempty"`
+	ProjectID *string  `json:"projectID,omitempty"`
+	// Prefix of the file path
+	Prefix string `json:"prefix,omitempty"`
+	// Tag of the file as "key=value"
+	Tag string `json:"tag,omitempty"`
+}
+
+// Validate checks that the filter selects known types and gives its tag
+// as "key=value".
+func (f Filter) Validate() error {
+	for _, t := range f.Types {
+		known := false
+		for _, eventType := range Types {
+			known = known || t == eventType
+		}
+		if !known {
+			return errors.New("unknown event type '" + t + "', expected one of " + strings.Join(Types, ", "))
+		}
+	}
+	if key, _, ok := strings.Cut(f.Tag, "="); f.Tag != "" && (!ok || key == "") {
+		return errors.New("tag must be given as key=value")
+	}
+	return nil
+}
+
+// Matches reports whether the filter selects e.
+func (f Filter) Matches(e Event) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			found = found || t == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.ProjectID != nil && *f.ProjectID != e.ProjectID {
+		return false
+	}
+	if !strings.HasPrefix(e.Path, f.Prefix) {
+		return false
+	}
+	if f.Tag != "" {
+		key, value, _ := strings.Cut(f.Tag, "=")
+		if v, ok := e.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// watchBuffer is the number of events a watcher may fall behind before it
+// is stopped.
+const watchBuffer = 256
+
+// Bus passes published events on to its subscribers and watchers, and
+// keeps the latest events so watchers can resume where they stopped. A nil
+// Bus drops all events.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []func(context.Context, Event)
+	watchers    map[*Watcher]struct{}
+	// Latest events, oldest first
+	history     []Event
+	historySize int
+}
+
+// NewBus returns a bus keeping the latest historySize events.
+func NewBus(historySize int) *Bus {
+	return &Bus{watchers: make(map[*Watcher]struct{}), historySize: historySize}
+}
+
+// Subscribe adds a function called with every published event and the
+// context of its publisher. It is called by the publisher, which waits for
+// it to return, outside of the lock of the bus.
+func (b *Bus) Subscribe(fn func(ctx context.Context, e Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// Publish passes e on to all subscribers and watchers.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil {
+		return
+	}
+	for _, fn := range b.watch(e) {
+		fn(ctx, e)
+	}
+}
+
+// watch adds e to the history, passes it on to the watchers and returns
+// the subscribers.
+func (b *Bus) watch(e Event) []func(context.Context, Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.historySize > 0 {
+		b.history = append(b.history, e)
+		if len(b.history) > b.historySize {
+			b.history = b.history[len(b.history)-b.historySize:]
+		}
+	}
+	for w := range b.watchers {
+		select {
+		case w.c <- e:
+		default:
+			// The watcher can resume from the history
+			b.stop(w)
+		}
+	}
+	return b.subscribers
+}
+
+// Watcher receives the events published after it was created.
+type Watcher struct {
+	// C is closed when the watcher is stopped or has fallen too far behind
+	C   <-chan Event
+	c   chan Event
+	bus *Bus
+}
+
+// Watch returns a watcher for the events published from now on, and the
+// events in the history that were published after the one with ID
+// lastEventID. If lastEventID is empty, no events are returned. If it is
+// no longer in the history, ok is false and events may have been missed.
+func (b *Bus) Watch(lastEventID string) (w *Watcher, missed []Event, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ok = lastEventID == ""
+	for i := len(b.history) - 1; i >= 0 && !ok; i-- {
+		if b.history[i].ID == lastEventID {
+			missed = append(missed, b.history[i+1:]...)
+			ok = true
+		}
+	}
+	c := make(chan Event, watchBuffer)
+	w = &Watcher{C: c, c: c, bus: b}
+	b.watchers[w] = struct{}{}
+	return w, missed, ok
+}
+
+// Stop stops the watcher and closes its channel.
+func (w *Watcher) Stop() {
+	w.bus.mu.Lock()
+	defer w.bus.mu.Unlock()
+
+	w.bus.stop(w)
+}
+
+func (b *Bus) stop(w *Watcher) {
+	if _, ok := b.watchers[w]; ok {
+		delete(b.watchers, w)
+		close(w.c)
+	}
+}
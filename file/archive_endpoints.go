@@ -0,0 +1,395 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/logging"
+)
+
+// rangeBlockSize is the number of bytes fetched with one range request.
+const rangeBlockSize = 256 << 10
+
+// objectReaderAt reads an object with range requests. The block read last
+// is kept, as the zip reader reads the central directory in small pieces.
+type objectReaderAt struct {
+	ctx         context.Context
+	store       ObjectStore
+	bucket      string
+	key         string
+	size        int64
+	block       []byte
+	blockOffset int64
+	// err is the last error of the object store
+	err error
+}
+
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		if off < r.blockOffset || off >= r.blockOffset+int64(len(r.block)) {
+			if err := r.fetch(off); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p[n:], r.block[off-r.blockOffset:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+func (r *objectReaderAt) fetch(off int64) error {
+	length := int64(rangeBlockSize)
+	if off+length > r.size {
+		length = r.size - off
+	}
+	content, err := r.store.GetObjectRange(r.ctx, r.bucket, r.key, off, length)
+	if err == nil {
+		defer content.Close()
+		block := make([]byte, length)
+		if _, err = io.ReadFull(content, block); err == nil {
+			r.block, r.blockOffset = block, off
+			return nil
+		}
+	}
+	r.err = err
+	return err
+}
+
+// storedArchive is an archive stored as a file.
+type storedArchive struct {
+	f      *FileController
+	ctx    context.Context
+	key    string
+	size   int64
+	format string
+}
+
+// openArchive returns the archive stored as a file, detecting its format.
+func (f *FileController) openArchive(ctx context.Context, fileID string, size int64) (*storedArchive, error) {
+	a := &storedArchive{f: f, ctx: ctx, key: f.objectKey(fileID), size: size}
+	if size > 0 {
+		length := int64(512)
+		if size < length {
+			length = size
+		}
+		content, err := f.ObjStore.GetObjectRange(ctx, f.Bucket, a.key, 0, length)
+		if err != nil {
+			return nil, err
+		}
+		defer content.Close()
+		head, err := io.ReadAll(content)
+		if err != nil {
+			return nil, err
+		}
+		a.format = archiveFormat(bytes.NewReader(head))
+	}
+	if a.format == "" {
+		return nil, &api.Error{
+			Code:    api.ErrorInvalidArchive,
+			Message: "file is not a ZIP, tar or gzipped tar archive",
+		}
+	}
+	return a, nil
+}
+
+// zipReader reads the central directory of a ZIP archive, fetching only
+// the end of the object.
+func (a *storedArchive) zipReader() (*zip.Reader, error) {
+	r := &objectReaderAt{ctx: a.ctx, store: a.f.ObjStore, bucket: a.f.Bucket, key: a.key, size: a.size}
+	zr, err := zip.NewReader(r, a.size)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err != nil {
+		return nil, invalidArchive(err)
+	}
+	return zr, nil
+}
+
+// walkTar calls fn for the regular files of a tar archive until it returns
+// false. The archive is read from the start, there is no index to skip to
+// an entry.
+func (a *storedArchive) walkTar(fn func(header *tar.Header, content io.Reader) (bool, error)) error {
+	content, err := a.f.ObjStore.GetObject(a.ctx, a.f.Bucket, a.key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	stream := &errReader{r: content}
+	var r io.Reader = stream
+	if a.format == "tar.gz" {
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return a.readError(stream, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return a.readError(stream, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		more, err := fn(header, tr)
+		if err != nil {
+			return a.readError(stream, err)
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// readError returns the error of the object store if reading the stream
+// failed, otherwise the archive is invalid.
+func (a *storedArchive) readError(stream *errReader, err error) error {
+	var apiErr *api.Error
+	switch {
+	case stream.err != nil:
+		return stream.err
+	case errors.As(err, &apiErr):
+		return err
+	}
+	return invalidArchive(err)
+}
+
+// entries returns the regular files of the archive. Entries pointing
+// outside of the archive are left out.
+func (a *storedArchive) entries() ([]api.ResponseArchiveEntryData, error) {
+	entries := []api.ResponseArchiveEntryData{}
+	add := func(name string, size int64, lastModified time.Time) {
+		if p, err := extractPath(name); err == nil && p != "" {
+			entries = append(entries, api.ResponseArchiveEntryData{Path: p, Size: size, LastModified: lastModified.UTC()})
+		}
+	}
+
+	if a.format == "zip" {
+		zr, err := a.zipReader()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range zr.File {
+			if entry.Mode().IsRegular() {
+				add(entry.Name, int64(entry.UncompressedSize64), entry.Modified)
+			}
+		}
+		return entries, nil
+	}
+	err := a.walkTar(func(header *tar.Header, content io.Reader) (bool, error) {
+		add(header.Name, header.Size, header.ModTime)
+		return true, nil
+	})
+	return entries, err
+}
+
+// writeEntry writes the content of an entry to c. The entries of ZIP
+// archives are read with a single range request.
+func (a *storedArchive) writeEntry(c *gin.Context, entryPath string) error {
+	if a.format == "zip" {
+		zr, err := a.zipReader()
+		if err != nil {
+			return err
+		}
+		for _, entry := range zr.File {
+			if p, err := extractPath(entry.Name); err == nil && p == entryPath && entry.Mode().IsRegular() {
+				return a.writeZipEntry(c, entry)
+			}
+		}
+		return entryNotFound(entryPath)
+	}
+
+	found := false
+	err := a.walkTar(func(header *tar.Header, content io.Reader) (bool, error) {
+		if p, err := extractPath(header.Name); err != nil || p != entryPath {
+			return true, nil
+		}
+		found = true
+		writeEntryHeaders(c, entryPath, header.Size)
+		_, err := io.Copy(c.Writer, content)
+		return false, err
+	})
+	if err == nil && !found {
+		return entryNotFound(entryPath)
+	}
+	return err
+}
+
+func (a *storedArchive) writeZipEntry(c *gin.Context, entry *zip.File) error {
+	if entry.Method != zip.Store && entry.Method != zip.Deflate {
+		return invalidArchive(errors.New("unsupported compression method " + strconv.Itoa(int(entry.Method))))
+	}
+	offset, err := entry.DataOffset()
+	if err != nil {
+		return invalidArchive(err)
+	}
+
+	var content io.Reader = http.NoBody
+	if entry.CompressedSize64 > 0 {
+		stream, err := a.f.ObjStore.GetObjectRange(a.ctx, a.f.Bucket, a.key, offset, int64(entry.CompressedSize64))
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		content = stream
+		if entry.Method == zip.Deflate {
+			decompressor := flate.NewReader(stream)
+			defer decompressor.Close()
+			content = decompressor
+		}
+	}
+	size := int64(entry.UncompressedSize64)
+	writeEntryHeaders(c, entry.Name, size)
+	_, err = io.Copy(c.Writer, io.LimitReader(content, size))
+	return err
+}
+
+func writeEntryHeaders(c *gin.Context, entryPath string, size int64) {
+	contentType := mime.TypeByExtension(path.Ext(entryPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Status(http.StatusOK)
+}
+
+func entryNotFound(entryPath string) error {
+	return &api.Error{
+		Code:    api.ErrorEntryNotFound,
+		Message: "archive has no file " + entryPath,
+	}
+}
+
+// archiveErrorJSON writes the response for an error reading a stored
+// archive.
+func archiveErrorJSON(c *gin.Context, err error) {
+	var apiErr *api.Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Code == api.ErrorEntryNotFound:
+		api.ErrorJSON(c, http.StatusNotFound, err)
+	case errors.As(err, &apiErr):
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+	default:
+		StorageErrorJSON(c, err)
+	}
+}
+
+// GetArchiveEntries godoc
+// @Summary List the files inside an archive
+// @Description Lists the files inside a stored ZIP, tar or gzipped tar archive without extracting it.
+// @Description Of ZIP archives only the central directory is read.
+// @ID GetArchiveEntries
+// @Tags files
+// @Produce json
+// @Success 200 {object} api.ResponseArchiveEntries "Files inside the archive"
+// @Failure 400 {object} api.ResponseError "Invalid file ID or file is no archive"
+// @Failure 404 {object} api.ResponseError "File not found"
+// @Failure 410 {object} api.ResponseError "File expired"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param fileID path string true "ID of file"
+// @Router /files/{fileID}/archive [get]
+func (f *FileController) GetArchiveEntries(c *gin.Context) {
+
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return
+	}
+	info, _, ok := f.statFile(c, fileID)
+	if !ok {
+		return
+	}
+	archive, err := f.openArchive(c.Request.Context(), fileID, info.Size)
+	if err != nil {
+		archiveErrorJSON(c, err)
+		return
+	}
+	entries, err := archive.entries()
+	if err != nil {
+		archiveErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseArchiveEntries{Data: entries})
+}
+
+// GetArchiveEntry godoc
+// @Summary Download a file inside an archive
+// @Description Streams a single file inside a stored ZIP, tar or gzipped tar archive. Of ZIP archives
+// @Description only the central directory and the file itself are read.
+// @ID GetArchiveEntry
+// @Tags files
+// @Produce octet-stream
+// @Success 200 {file} file "Content of the file"
+// @Failure 400 {object} api.ResponseError "Invalid file ID or file is no archive"
+// @Failure 404 {object} api.ResponseError "File not found or not in the archive"
+// @Failure 410 {object} api.ResponseError "File expired"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param fileID path string true "ID of file"
+// @Param path path string true "Path of the file inside the archive"
+// @Router /files/{fileID}/archive/{path} [get]
+func (f *FileController) GetArchiveEntry(c *gin.Context) {
+
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return
+	}
+	entryPath, err := extractPath(strings.TrimPrefix(c.Param("path"), "/"))
+	if err != nil || entryPath == "" {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest,
+			errors.New("invalid path '"+c.Param("path")+"'")))
+		return
+	}
+	info, _, ok := f.statFile(c, fileID)
+	if !ok {
+		return
+	}
+	archive, err := f.openArchive(c.Request.Context(), fileID, info.Size)
+	if err != nil {
+		archiveErrorJSON(c, err)
+		return
+	}
+	if err := archive.writeEntry(c, entryPath); err != nil {
+		if c.Writer.Written() {
+			// The status has been sent, the client sees a short body
+			logging.FromContext(c.Request.Context()).Error("streaming archive entry",
+				"file_id", fileID, "path", entryPath, "error", err)
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Length")
+		archiveErrorJSON(c, err)
+	}
+}
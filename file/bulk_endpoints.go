@@ -0,0 +1,316 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/events"
+)
+
+// bulkBatchSize is the number of objects deleted with one request.
+const bulkBatchSize = 1000
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// bulkResults collects the results of a bulk operation. If the client
+// accepts newline-delimited JSON, each result is streamed right away
+// instead.
+type bulkResults struct {
+	c       *gin.Context
+	stream  bool
+	enc     *json.Encoder
+	results []api.ResponseBulkResult
+}
+
+func newBulkResults(c *gin.Context) *bulkResults {
+	return &bulkResults{
+		c:       c,
+		stream:  strings.Contains(c.GetHeader("Accept"), contentTypeNDJSON),
+		results: []api.ResponseBulkResult{},
+	}
+}
+
+// add records the result of the operation on a file, err is nil on
+// success.
+func (r *bulkResults) add(fileID string, err error) {
+	result := api.ResponseBulkResult{FileID: fileID, Code: http.StatusOK}
+	if err != nil {
+		status, err := bulkItemError(fileID, err)
+		data := api.ErrorData(r.c.Request.Context(), status, err)
+		result.Code = status
+		result.Error = &data
+	}
+	if !r.stream {
+		r.results = append(r.results, result)
+		return
+	}
+	if r.enc == nil {
+		r.c.Header("Content-Type", contentTypeNDJSON)
+		r.c.Status(http.StatusOK)
+		r.enc = json.NewEncoder(r.c.Writer)
+	}
+	r.enc.Encode(result)
+	r.c.Writer.Flush()
+}
+
+// finish writes the collected results.
+func (r *bulkResults) finish() {
+	if !r.stream {
+		r.c.PureJSON(http.StatusOK, api.ResponseBulk{Data: r.results})
+	} else if r.enc == nil {
+		r.c.Header("Content-Type", contentTypeNDJSON)
+		r.c.Status(http.StatusOK)
+	}
+}
+
+// bulkItemError returns the status and error of the result of a file.
+func bulkItemError(fileID string, err error) (int, error) {
+	var apiErr *api.Error
+	var noSuchKeyError *NoSuchKeyError
+	var collectionNotFoundError *CollectionNotFoundError
+	switch {
+	case errors.As(err, &apiErr):
+		return http.StatusBadRequest, err
+	case errors.As(err, &noSuchKeyError):
+		return http.StatusNotFound, &api.Error{
+			Code:    api.ErrorFileNotFound,
+			Message: "file not found: " + fileID,
+			Err:     err,
+		}
+	case errors.As(err, &collectionNotFoundError):
+		return http.StatusBadRequest, codedError(api.ErrorCollectionNotFound, err)
+	}
+	return storageError(err)
+}
+
+// bulkOperation changes the files and adds their results.
+type bulkOperation func(ctx context.Context, fileIDs []string, results *bulkResults)
+
+// bulkOperation returns the operation of a request, checking its
+// parameters.
+func (f *FileController) bulkOperation(req api.RequestBulk) (bulkOperation, error) {
+	switch req.Operation {
+	case "delete":
+		return f.bulkDelete, nil
+	case "tag":
+		for key := range req.Tags {
+			if key == "" {
+				return nil, errors.New("tag keys must not be empty")
+			}
+		}
+		return f.bulkUpdate(func(meta *FileMeta) {
+			// The tags of meta are shared with the store, so a copy is changed
+			tags := make(map[string]string, len(meta.Tags)+len(req.Tags))
+			for key, value := range meta.Tags {
+				tags[key] = value
+			}
+			for key, value := range req.Tags {
+				tags[key] = value
+			}
+			for _, key := range req.RemoveTags {
+				delete(tags, key)
+			}
+			meta.Tags = nil
+			if len(tags) > 0 {
+				meta.Tags = tags
+			}
+		}), nil
+	case "move":
+		if req.CollectionID != "" {
+			if _, err := f.Meta.Collection(req.CollectionID); err != nil {
+				return nil, codedError(api.ErrorCollectionNotFound, err)
+			}
+		}
+		return f.bulkUpdate(func(meta *FileMeta) {
+			meta.CollectionID = req.CollectionID
+		}), nil
+	case "expire":
+		expiresAt, err := parseExpiry(req.ExpiresAt, req.TTL)
+		if err != nil {
+			return nil, err
+		}
+		return f.bulkUpdate(func(meta *FileMeta) {
+			meta.ExpiresAt = expiresAt
+		}), nil
+	}
+	return nil, errors.New("unknown operation '" + req.Operation + "', expected delete, tag, move or expire")
+}
+
+// bulkDelete deletes the files, or moves them to the trash, in batches.
+func (f *FileController) bulkDelete(ctx context.Context, fileIDs []string, results *bulkResults) {
+	for start := 0; start < len(fileIDs); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(fileIDs) {
+			end = len(fileIDs)
+		}
+
+		// Adopted files are not stored at their IDs, so the ID of each
+		// key is kept at the same index
+		var deleted, keys []string
+		for _, fileID := range fileIDs[start:end] {
+			if f.TrashRetention > 0 {
+				if err := f.copyToTrash(ctx, fileID); err != nil {
+					results.add(fileID, err)
+					continue
+				}
+			}
+			deleted = append(deleted, fileID)
+			keys = append(keys, f.objectKey(fileID))
+		}
+		errs := f.ObjStore.DeleteObjects(ctx, f.Bucket, keys)
+		for i, fileID := range deleted {
+			meta := f.Meta.File(fileID)
+			err := errs[keys[i]]
+			switch {
+			case err != nil && f.TrashRetention > 0:
+				f.discardTrashCopy(ctx, fileID)
+			case err == nil && f.TrashRetention > 0:
+				err = f.markTrashed(ctx, fileID)
+			case err == nil:
+				err = f.Meta.DeleteFile(ctx, fileID)
+			}
+			if err == nil {
+				f.publish(ctx, events.FileDeleted, meta, 0)
+			}
+			results.add(fileID, err)
+		}
+	}
+}
+
+// bulkUpdate returns an operation that changes the metadata of the files.
+func (f *FileController) bulkUpdate(update func(meta *FileMeta)) bulkOperation {
+	return func(ctx context.Context, fileIDs []string, results *bulkResults) {
+		for _, fileID := range fileIDs {
+			meta := f.Meta.File(fileID)
+			update(&meta)
+			err := f.Meta.PutFile(ctx, meta)
+			if err == nil {
+				f.publish(ctx, events.FileMetadataChanged, meta, 0)
+			}
+			results.add(fileID, err)
+		}
+	}
+}
+
+// filterFiles returns the IDs of the files that match filter.
+func (f *FileController) filterFiles(ctx context.Context, filter api.RequestBulkFilter) ([]string, error) {
+	var tagKey, tagValue string
+	if filter.Tag != "" {
+		var ok bool
+		if tagKey, tagValue, ok = strings.Cut(filter.Tag, "="); !ok || tagKey == "" {
+			return nil, codedError(api.ErrorInvalidRequest, errors.New("filter tag must be given as key=value"))
+		}
+	}
+	if filter.CollectionID != nil && *filter.CollectionID != "" {
+		if _, err := f.Meta.Collection(*filter.CollectionID); err != nil {
+			return nil, codedError(api.ErrorCollectionNotFound, err)
+		}
+	}
+
+	files, err := f.listFiles(ctx, func(meta FileMeta) bool {
+		if filter.CollectionID != nil && meta.CollectionID != *filter.CollectionID {
+			return false
+		}
+		if value, ok := meta.Tags[tagKey]; tagKey != "" && (!ok || value != tagValue) {
+			return false
+		}
+		return strings.HasPrefix(f.filePath(meta), filter.Prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+	fileIDs := make([]string, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.FileID
+	}
+	return fileIDs, nil
+}
+
+// BulkFiles godoc
+// @Summary Delete, tag, move or expire many files
+// @Description Applies an operation to the files given by ID or matching a filter and returns the
+// @Description result for each file. Send "Accept: application/x-ndjson" to receive the results
+// @Description as a stream of JSON lines while the operation progresses.
+// @ID BulkFiles
+// @Tags files
+// @Accept json
+// @Produce json,application/x-ndjson
+// @Success 200 {object} api.ResponseBulk "Result by file"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Collection not found"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param operation body api.RequestBulk true "Operation and the files to apply it to"
+// @Router /files/bulk [post]
+func (f *FileController) BulkFiles(c *gin.Context) {
+
+	var req api.RequestBulk
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	if (len(req.FileIDs) == 0) == (req.Filter == nil) {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest,
+			errors.New("give either fileIDs or a filter")))
+		return
+	}
+	operation, err := f.bulkOperation(req)
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		api.ErrorJSON(c, http.StatusBadRequest, apiErr)
+		return
+	}
+	if err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := newBulkResults(c)
+	var fileIDs []string
+	if req.Filter != nil {
+		fileIDs, err = f.filterFiles(ctx, *req.Filter)
+		var collectionNotFoundError *CollectionNotFoundError
+		switch {
+		case errors.As(err, &collectionNotFoundError):
+			api.ErrorJSON(c, http.StatusNotFound, err)
+			return
+		case errors.As(err, &apiErr):
+			api.ErrorJSON(c, http.StatusBadRequest, err)
+			return
+		case err != nil:
+			StorageErrorJSON(c, err)
+			return
+		}
+	} else {
+		// Only existing files are passed on to the operation
+		for _, fileID := range req.FileIDs {
+			if id, err := uuid.Parse(fileID); err != nil || id.String() != fileID {
+				results.add(fileID, &api.Error{
+					Code:    api.ErrorInvalidFileID,
+					Message: "invalid file ID: " + fileID,
+					Err:     err,
+				})
+				continue
+			}
+			if _, err := f.ObjStore.StatObject(ctx, f.Bucket, f.objectKey(fileID)); err != nil {
+				results.add(fileID, err)
+				continue
+			}
+			fileIDs = append(fileIDs, fileID)
+		}
+	}
+
+	operation(ctx, fileIDs, results)
+	results.finish()
+}
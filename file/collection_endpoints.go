@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sogno-platform/file-service/api"
+)
+
+func RegisterCollectionEndpoints(r *gin.RouterGroup, resolve Resolver) {
+	r.GET("", resolve.handle((*FileController).GetCollectionContents))
+	r.POST("", resolve.handle((*FileController).AddCollection))
+	r.GET("/:collectionID", resolve.handle((*FileController).GetCollection))
+	r.PUT("/:collectionID", resolve.handle((*FileController).UpdateCollection))
+	r.DELETE("/:collectionID", resolve.handle((*FileController).DeleteCollection))
+}
+
+func (f *FileController) collectionData(collection Collection) api.ResponseCollectionData {
+	return api.ResponseCollectionData{
+		CollectionID: collection.CollectionID,
+		Name:         collection.Name,
+		ParentID:     collection.ParentID,
+		Path:         f.Meta.CollectionPath(collection.CollectionID),
+		CreatedAt:    collection.CreatedAt,
+	}
+}
+
+// collectionErrorJSON writes the response for an error returned by the
+// collection methods of MetaStore.
+func collectionErrorJSON(c *gin.Context, err error) {
+	var notFoundError *CollectionNotFoundError
+	var conflictError *CollectionConflictError
+	switch {
+	case errors.As(err, &notFoundError):
+		api.ErrorJSON(c, http.StatusNotFound, codedError(api.ErrorCollectionNotFound, err))
+	case errors.As(err, &conflictError):
+		api.ErrorJSON(c, http.StatusConflict, codedError(api.ErrorCollectionConflict, err))
+	default:
+		StorageErrorJSON(c, err)
+	}
+}
+
+func bindCollection(c *gin.Context) (api.RequestCollection, bool) {
+	var req api.RequestCollection
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return req, false
+	}
+	if strings.Contains(req.Name, "/") {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest,
+			errors.New("collection name must not contain slashes")))
+		return req, false
+	}
+	return req, true
+}
+
+// GetCollectionContents godoc
+// @Summary List the contents of a collection
+// @Description Lists the collections and files directly inside a collection,
+// @Description nested collections are not descended into.
+// @ID GetCollectionContents
+// @Tags collections
+// @Produce json
+// @Success 200 {object} api.ResponseCollectionContents "Contents of collection"
+// @Failure 404 {object} api.ResponseError "Collection not found"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param parentID query string false "ID of collection to list, omit for the top level"
+// @Router /collections [get]
+func (f *FileController) GetCollectionContents(c *gin.Context) {
+
+	parentID := c.Query("parentID")
+	children, err := f.Meta.Collections(parentID)
+	if err != nil {
+		collectionErrorJSON(c, err)
+		return
+	}
+	files, err := f.listFiles(c.Request.Context(), func(meta FileMeta) bool {
+		return meta.CollectionID == parentID
+	})
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+
+	contents := api.ResponseCollectionContentsData{
+		Collections: []api.ResponseCollectionData{},
+		Files:       []api.ResponseFileData{},
+	}
+	for _, child := range children {
+		contents.Collections = append(contents.Collections, f.collectionData(child))
+	}
+	contents.Files = append(contents.Files, files...)
+	c.PureJSON(http.StatusOK, api.ResponseCollectionContents{Data: contents})
+}
+
+// AddCollection godoc
+// @Summary Add collection
+// @ID AddCollection
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.ResponseCollection "Collection that was added"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Parent collection not found"
+// @Failure 409 {object} api.ResponseError "A sibling with the same name exists"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param collection body api.RequestCollection true "Collection to be added"
+// @Router /collections [post]
+func (f *FileController) AddCollection(c *gin.Context) {
+
+	req, ok := bindCollection(c)
+	if !ok {
+		return
+	}
+	parentID := ""
+	if req.ParentID != nil {
+		parentID = *req.ParentID
+	}
+	collection, err := f.Meta.CreateCollection(c.Request.Context(), req.Name, parentID)
+	if err != nil {
+		collectionErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseCollection{Data: f.collectionData(collection)})
+}
+
+// GetCollection godoc
+// @Summary Get collection info
+// @ID GetCollection
+// @Tags collections
+// @Produce json
+// @Success 200 {object} api.ResponseCollection "Collection info"
+// @Failure 404 {object} api.ResponseError "Collection not found"
+// @Param collectionID path string true "ID of collection"
+// @Router /collections/{collectionID} [get]
+func (f *FileController) GetCollection(c *gin.Context) {
+
+	collection, err := f.Meta.Collection(c.Param("collectionID"))
+	if err != nil {
+		collectionErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseCollection{Data: f.collectionData(collection)})
+}
+
+// UpdateCollection godoc
+// @Summary Rename or move collection
+// @Description Files and collections inside the collection move along with it. Omit parentID to keep
+// @Description the current parent.
+// @ID UpdateCollection
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.ResponseCollection "Collection that was updated"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Collection not found"
+// @Failure 409 {object} api.ResponseError "Name taken or move into itself"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param collectionID path string true "ID of collection"
+// @Param collection body api.RequestCollection true "New name and parent of collection"
+// @Router /collections/{collectionID} [put]
+func (f *FileController) UpdateCollection(c *gin.Context) {
+
+	req, ok := bindCollection(c)
+	if !ok {
+		return
+	}
+	collection, err := f.Meta.UpdateCollection(c.Request.Context(), c.Param("collectionID"), req.Name, req.ParentID)
+	if err != nil {
+		collectionErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseCollection{Data: f.collectionData(collection)})
+}
+
+// DeleteCollection godoc
+// @Summary Delete empty collection
+// @ID DeleteCollection
+// @Tags collections
+// @Produce json
+// @Success 200 {object} api.ResponseEmpty "Collection was deleted"
+// @Failure 404 {object} api.ResponseError "Collection not found"
+// @Failure 409 {object} api.ResponseError "Collection is not empty"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param collectionID path string true "ID of collection"
+// @Router /collections/{collectionID} [delete]
+func (f *FileController) DeleteCollection(c *gin.Context) {
+
+	err := f.Meta.DeleteCollection(c.Request.Context(), c.Param("collectionID"))
+	if err != nil {
+		collectionErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseEmpty{})
+}
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/logging"
+)
+
+// archiveEntry is a file to be written to a downloaded archive.
+type archiveEntry struct {
+	fileID       string
+	path         string
+	size         int64
+	lastModified time.Time
+}
+
+// archiveWriter writes the entries of an archive format.
+type archiveWriter interface {
+	create(entry archiveEntry) (io.Writer, error)
+	// close completes the archive, it is left incomplete on errors
+	close() error
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z *zipWriter) create(entry archiveEntry) (io.Writer, error) {
+	return z.w.CreateHeader(&zip.FileHeader{
+		Name:     entry.path,
+		Method:   zip.Deflate,
+		Modified: entry.lastModified,
+	})
+}
+
+func (z *zipWriter) close() error {
+	return z.w.Close()
+}
+
+type tarGzipWriter struct {
+	gz *gzip.Writer
+	w  *tar.Writer
+}
+
+func (t *tarGzipWriter) create(entry archiveEntry) (io.Writer, error) {
+	err := t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.path,
+		Size:     entry.size,
+		Mode:     0644,
+		ModTime:  entry.lastModified,
+	})
+	return t.w, err
+}
+
+func (t *tarGzipWriter) close() error {
+	if err := t.w.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+// archiveEntries returns the entries of the requested files, named by their
+// path. Files whose path is taken get their ID as a prefix.
+func (f *FileController) archiveEntries(ctx context.Context, req api.RequestDownload) ([]archiveEntry, error) {
+	fileIDs := req.FileIDs
+	if req.Filter != nil {
+		var err error
+		if fileIDs, err = f.filterFiles(ctx, *req.Filter); err != nil {
+			return nil, err
+		}
+	}
+	for _, fileID := range fileIDs {
+		if id, err := uuid.Parse(fileID); err != nil || id.String() != fileID {
+			return nil, &api.Error{
+				Code:    api.ErrorInvalidFileID,
+				Message: "invalid file ID: " + fileID,
+				Err:     err,
+			}
+		}
+	}
+
+	var entries []archiveEntry
+	taken := make(map[string]bool)
+	for _, fileID := range fileIDs {
+		info, err := f.ObjStore.StatObject(ctx, f.Bucket, f.objectKey(fileID))
+		var noSuchKeyError *NoSuchKeyError
+		if errors.As(err, &noSuchKeyError) {
+			return nil, &api.Error{
+				Code:    api.ErrorFileNotFound,
+				Message: "file not found: " + fileID,
+				Err:     err,
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		meta := f.Meta.File(fileID)
+		entry := archiveEntry{
+			fileID:       fileID,
+			path:         archivePath(f.filePath(meta)),
+			size:         info.Size,
+			lastModified: info.LastModified,
+		}
+		if taken[entry.path] {
+			dir, name := path.Split(entry.path)
+			entry.path = dir + fileID + "-" + name
+		}
+		taken[entry.path] = true
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// DownloadFiles godoc
+// @Summary Download many files as one archive
+// @Description Streams a ZIP or gzipped tar archive of the files given by ID or matching a filter.
+// @Description Files are named by their collections and original name. If the object store fails
+// @Description while the archive is streamed, the archive ends incomplete.
+// @ID DownloadFiles
+// @Tags files
+// @Accept json
+// @Produce application/zip,application/gzip
+// @Success 200 {file} file "Archive of the files"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "File or collection not found"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param files body api.RequestDownload true "Files to download and archive format"
+// @Router /files/download [post]
+func (f *FileController) DownloadFiles(c *gin.Context) {
+
+	var req api.RequestDownload
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	if (len(req.FileIDs) == 0) == (req.Filter == nil) {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest,
+			errors.New("give either fileIDs or a filter")))
+		return
+	}
+	var contentType, extension string
+	switch req.Format {
+	case "", "zip":
+		contentType, extension = "application/zip", ".zip"
+	case "tar.gz":
+		contentType, extension = "application/gzip", ".tar.gz"
+	default:
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest,
+			errors.New("unknown archive format '"+req.Format+"', expected zip or tar.gz")))
+		return
+	}
+
+	ctx := c.Request.Context()
+	entries, err := f.archiveEntries(ctx, req)
+	var apiErr *api.Error
+	switch {
+	case errors.As(err, &apiErr) && (apiErr.Code == api.ErrorFileNotFound || apiErr.Code == api.ErrorCollectionNotFound):
+		api.ErrorJSON(c, http.StatusNotFound, err)
+		return
+	case errors.As(err, &apiErr):
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return
+	case err != nil:
+		StorageErrorJSON(c, err)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="files`+extension+`"`)
+	c.Status(http.StatusOK)
+	var archive archiveWriter
+	if extension == ".zip" {
+		archive = &zipWriter{w: zip.NewWriter(c.Writer)}
+	} else {
+		gz := gzip.NewWriter(c.Writer)
+		archive = &tarGzipWriter{gz: gz, w: tar.NewWriter(gz)}
+	}
+
+	for _, entry := range entries {
+		if err := f.writeArchiveEntry(ctx, archive, entry); err != nil {
+			// The status has been sent, leaving the archive incomplete is
+			// the only way to tell the client
+			logging.FromContext(ctx).Error("streaming archive",
+				"file_id", entry.fileID, "error", err)
+			return
+		}
+	}
+	if err := archive.close(); err != nil {
+		logging.FromContext(ctx).Error("streaming archive", "error", err)
+	}
+}
+
+func (f *FileController) writeArchiveEntry(ctx context.Context, archive archiveWriter, entry archiveEntry) error {
+	content, err := f.ObjStore.GetObject(ctx, f.Bucket, f.objectKey(entry.fileID))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	w, err := archive.create(entry)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// archivePath returns p as a relative path that does not leave the
+// directory an archive is extracted to.
+func archivePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/")
+}
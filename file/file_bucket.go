@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/sse"
+
+	"github.com/sogno-platform/file-service/config"
+)
+
+// provisionTimeout bounds the checks at startup, so an unreachable object
+// store fails the service instead of blocking it.
+const provisionTimeout = 30 * time.Second
+
+// ProvisionBucket checks that the service can use a bucket, creates it if
+// allowed and applies the configured settings to it. Errors describe what
+// needs to be fixed.
+func (c *MinIOClient) ProvisionBucket(bucket string, settings config.BucketSettings) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), provisionTimeout)
+	defer cancel()
+
+	exists, err := c.Client.BucketExists(ctx, bucket)
+	if err != nil {
+		return c.diagnose(bucket, "checking bucket", err)
+	}
+	if !exists {
+		if !settings.Create {
+			return fmt.Errorf("bucket '%s' does not exist at %s: create it or set 'bucket.create' to true",
+				bucket, c.Client.EndpointURL().Host)
+		}
+		if err := c.Client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return c.diagnose(bucket, "creating bucket", err)
+		}
+	}
+
+	if settings.Versioning {
+		if err := c.Client.EnableVersioning(ctx, bucket); err != nil {
+			return c.diagnose(bucket, "enabling versioning", err)
+		}
+	}
+
+	switch settings.Encryption {
+	case "sse-s3":
+		err = c.Client.SetBucketEncryption(ctx, bucket, sse.NewConfigurationSSES3())
+	case "sse-kms":
+		err = c.Client.SetBucketEncryption(ctx, bucket, sse.NewConfigurationSSEKMS(settings.KMSKeyID))
+	}
+	if err != nil {
+		return c.diagnose(bucket, "setting encryption", err)
+	}
+
+	if rules := lifecycleRules(settings); len(rules) > 0 {
+		// Rules set by operators are kept next to those of the service
+		lc, err := c.Client.GetBucketLifecycle(ctx, bucket)
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return c.diagnose(bucket, "reading lifecycle", err)
+		}
+		if lc == nil {
+			lc = lifecycle.NewConfiguration()
+		}
+		lc.Rules = mergeLifecycleRules(lc.Rules, rules)
+		if err := c.Client.SetBucketLifecycle(ctx, bucket, lc); err != nil {
+			return c.diagnose(bucket, "setting lifecycle", err)
+		}
+	}
+	return nil
+}
+
+// lifecycleRulePrefix marks the IDs of the lifecycle rules managed by the
+// service.
+const lifecycleRulePrefix = "sogno-"
+
+// mergeLifecycleRules replaces the rules of the service among the existing
+// rules of a bucket.
+func mergeLifecycleRules(existing []lifecycle.Rule, rules []lifecycle.Rule) []lifecycle.Rule {
+	merged := make([]lifecycle.Rule, 0, len(existing)+len(rules))
+	for _, rule := range existing {
+		if !strings.HasPrefix(rule.ID, lifecycleRulePrefix) {
+			merged = append(merged, rule)
+		}
+	}
+	return append(merged, rules...)
+}
+
+func lifecycleRules(settings config.BucketSettings) []lifecycle.Rule {
+	var rules []lifecycle.Rule
+	if settings.NoncurrentExpiryDays > 0 {
+		rules = append(rules, lifecycle.Rule{
+			ID:     lifecycleRulePrefix + "noncurrent-expiry",
+			Status: "Enabled",
+			NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+				NoncurrentDays: lifecycle.ExpirationDays(settings.NoncurrentExpiryDays),
+			},
+		})
+	}
+	if settings.AbortUploadsDays > 0 {
+		rules = append(rules, lifecycle.Rule{
+			ID:     lifecycleRulePrefix + "abort-uploads",
+			Status: "Enabled",
+			AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: lifecycle.ExpirationDays(settings.AbortUploadsDays),
+			},
+		})
+	}
+	return rules
+}
+
+// CheckBucket verifies that the object store is reachable and the bucket
+// is accessible.
+func (c *MinIOClient) CheckBucket(ctx context.Context, bucket string) error {
+
+	ctx, end := begin(ctx, "BucketExists", c.Timeouts.Stat, bucket, "")
+	exists, err := c.Client.BucketExists(ctx, bucket)
+	end(err)
+	if err != nil {
+		return c.diagnose(bucket, "checking bucket", err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket '%s' does not exist", bucket)
+	}
+	return nil
+}
+
+// diagnose turns an error of the object store into a hint at its cause.
+func (c *MinIOClient) diagnose(bucket string, action string, err error) error {
+	endpoint := c.Client.EndpointURL().Host
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return fmt.Errorf("%s '%s': cannot reach object store at %s: %w", action, bucket, endpoint, err)
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "InvalidAccessKeyId", "SignatureDoesNotMatch", "InvalidToken", "ExpiredToken":
+		return fmt.Errorf("%s '%s': credentials were rejected by %s, check storage.credentials or the MINIO_* and AWS_* environment variables: %w",
+			action, bucket, endpoint, err)
+	case "AccessDenied":
+		return fmt.Errorf("%s '%s': access denied by %s, check the permissions of the credentials: %w",
+			action, bucket, endpoint, err)
+	case "NotImplemented":
+		return fmt.Errorf("%s '%s': not supported by the object store at %s, disable the setting: %w",
+			action, bucket, endpoint, err)
+	}
+	return fmt.Errorf("%s '%s' at %s: %w", action, bucket, endpoint, err)
+}
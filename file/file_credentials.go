@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/sogno-platform/file-service/config"
+)
+
+// reloadableProvider lets the credentials change while the client is in
+// use. Providers are called outside the lock, as fetching credentials may
+// take a network round trip.
+type reloadableProvider struct {
+	mu       sync.Mutex
+	provider credentials.Provider
+	changed  bool
+}
+
+func (p *reloadableProvider) Retrieve() (credentials.Value, error) {
+	p.mu.Lock()
+	provider := p.provider
+	p.changed = false
+	p.mu.Unlock()
+
+	return provider.Retrieve()
+}
+
+func (p *reloadableProvider) IsExpired() bool {
+	p.mu.Lock()
+	provider, changed := p.provider, p.changed
+	p.mu.Unlock()
+
+	return changed || provider.IsExpired()
+}
+
+func (p *reloadableProvider) set(provider credentials.Provider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.provider = provider
+	p.changed = true
+}
+
+// credentialProvider returns the provider of the credentials to sign
+// requests with. The first source that yields keys wins: configured keys,
+// configured web identity, MinIO and AWS environment variables, the AWS and
+// MinIO client credential files and, if enabled, the instance role.
+func credentialProvider(endpoint string, storage config.StorageSettings) credentials.Provider {
+	settings := storage.Credentials
+	var providers []credentials.Provider
+	if settings.AccessKey != "" {
+		providers = append(providers, &credentials.Static{
+			Value: credentials.Value{
+				AccessKeyID:     settings.AccessKey,
+				SecretAccessKey: settings.SecretKey,
+				SessionToken:    settings.SessionToken,
+				SignerType:      credentials.SignatureV4,
+			},
+		})
+	}
+	if settings.WebIdentityTokenFile != "" {
+		stsEndpoint := settings.STSEndpoint
+		if stsEndpoint == "" {
+			stsEndpoint = "http://" + endpoint
+			if storage.Secure {
+				stsEndpoint = "https://" + endpoint
+			}
+		}
+		providers = append(providers, &credentials.STSWebIdentity{
+			Client:      &http.Client{Transport: http.DefaultTransport},
+			STSEndpoint: stsEndpoint,
+			RoleARN:     settings.RoleARN,
+			GetWebIDTokenExpiry: func() (*credentials.WebIdentityToken, error) {
+				// Read the token on every refresh, it is rotated on disk
+				token, err := os.ReadFile(settings.WebIdentityTokenFile)
+				if err != nil {
+					return nil, err
+				}
+				return &credentials.WebIdentityToken{Token: string(token)}, nil
+			},
+		})
+	}
+	providers = append(providers,
+		&credentials.EnvMinio{},
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.FileMinioClient{},
+	)
+	if settings.IAM {
+		providers = append(providers, &credentials.IAM{
+			Client:   &http.Client{Transport: http.DefaultTransport},
+			Endpoint: settings.IAMEndpoint,
+		})
+	}
+	return &credentials.Chain{Providers: providers}
+}
+
+// bucketLookup maps the addressing setting to the lookup of the client.
+// Path-style addressing suits MinIO and Ceph RGW without wildcard DNS.
+func bucketLookup(addressing string) minio.BucketLookupType {
+	switch addressing {
+	case "path":
+		return minio.BucketLookupPath
+	case "virtual-host":
+		return minio.BucketLookupDNS
+	}
+	return minio.BucketLookupAuto
+}
@@ -3,58 +3,412 @@
 package file
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
 
 	"github.com/sogno-platform/file-service/api"
 	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/events"
 )
 
-func RegisterFileEndpoints(r *gin.RouterGroup) {
-	controller, err := NewFileController()
-	if err != nil {
-		log.Fatalln(err)
+func RegisterFileEndpoints(r *gin.RouterGroup, resolve Resolver) {
+	r.GET("", resolve.handle((*FileController).GetFiles))
+	r.POST("", resolve.handle((*FileController).AddFile))
+	r.POST("/bulk", resolve.handle((*FileController).BulkFiles))
+	r.POST("/download", resolve.handle((*FileController).DownloadFiles))
+	r.GET("/events", resolve.handle((*FileController).GetFileEvents))
+	r.GET("/:fileID", resolve.handle((*FileController).GetFile))
+	r.PUT("/:fileID", resolve.handle((*FileController).UpdateFile))
+	r.DELETE("/:fileID", resolve.handle((*FileController).DeleteFile))
+	r.POST("/:fileID/move", resolve.handle((*FileController).MoveFile))
+	r.POST("/:fileID/copy", resolve.handle((*FileController).CopyFile))
+	r.GET("/:fileID/archive", resolve.handle((*FileController).GetArchiveEntries))
+	r.GET("/:fileID/archive/*path", resolve.handle((*FileController).GetArchiveEntry))
+	r.PUT("/:fileID/expiry", resolve.handle((*FileController).SetExpiry))
+}
+
+// Resolver returns the FileController that serves a request. If there is
+// none, it writes an error response and returns false.
+type Resolver func(c *gin.Context) (*FileController, bool)
+
+// StaticResolver serves all requests with the same controller.
+func StaticResolver(controller *FileController) Resolver {
+	return func(c *gin.Context) (*FileController, bool) {
+		return controller, true
+	}
+}
+
+func (resolve Resolver) handle(handler func(*FileController, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if controller, ok := resolve(c); ok {
+			handler(controller, c)
+		}
 	}
-	r.GET("", controller.GetFiles)
-	r.POST("", controller.AddFile)
-	r.GET("/:fileID", controller.GetFile)
-	r.PUT("/:fileID", controller.UpdateFile)
-	r.DELETE("/:fileID", controller.DeleteFile)
 }
 
+// FileController serves the files below Prefix in Bucket.
 type FileController struct {
 	Bucket   string
-	ObjStore *MinIOClient
+	Prefix   string
+	ObjStore ObjectStore
+	Meta     *MetaStore
+	// Upload limits, shared by all controllers and replaced on reload
+	Upload *config.Value[config.UploadSettings]
+	// Rules that let files expire without an expiry of their own
+	ExpiryRules []config.ExpiryRule
+	// How long deleted files are kept in the trash, 0 to delete them
+	// right away
+	TrashRetention time.Duration
+	// Looks up the files of a project to copy files to, nil without
+	// projects
+	Projects func(projectID string) (*FileController, bool)
+	// Project of the files, empty outside of projects
+	ProjectID string
+	// Receives the lifecycle events of the files, nil to drop them
+	Events *events.Bus
+	// Interval of comments sent on idle event streams
+	EventHeartbeat time.Duration
+}
+
+// ControllerSettings are shared by the file controllers of the service.
+type ControllerSettings struct {
+	Upload         *config.Value[config.UploadSettings]
+	ExpiryRules    []config.ExpiryRule
+	TrashRetention time.Duration
+	Events         *events.Bus
+	EventHeartbeat time.Duration
+}
+
+func NewFileController(store ObjectStore, bucket string, prefix string, settings ControllerSettings) (*FileController, error) {
+	meta, err := NewMetaStore(context.Background(), store, bucket, prefix)
+	return &FileController{
+		Bucket:         bucket,
+		Prefix:         prefix,
+		ObjStore:       store,
+		Meta:           meta,
+		Upload:         settings.Upload,
+		ExpiryRules:    settings.ExpiryRules,
+		TrashRetention: settings.TrashRetention,
+		Events:         settings.Events,
+		EventHeartbeat: settings.EventHeartbeat,
+	}, err
+}
+
+// statusClientClosedRequest is logged when the client hung up before the
+// object store answered.
+const statusClientClosedRequest = 499
+
+// codedError attaches an error code to an error whose message is fit for
+// users.
+func codedError(code string, err error) *api.Error {
+	return &api.Error{Code: code, Message: err.Error(), Err: err}
+}
+
+// StorageErrorJSON writes the response for a failed storage operation. The
+// messages of the object store are only logged.
+func StorageErrorJSON(c *gin.Context, err error) {
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		c.Header("Retry-After", strconv.Itoa(retryAfter(openErr)))
+	}
+	status, apiErr := storageError(err)
+	api.ErrorJSON(c, status, apiErr)
+}
+
+// storageError returns the status and error of the response for a failed
+// storage operation.
+func storageError(err error) (int, error) {
+	var openErr *CircuitOpenError
+	switch {
+	case errors.As(err, &openErr):
+		apiErr := &api.Error{
+			Code:    api.ErrorStorageUnavailable,
+			Message: "object store is unavailable",
+			Err:     err,
+		}
+		return http.StatusServiceUnavailable, apiErr.WithDetail("retryAfter", retryAfter(openErr))
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, &api.Error{
+			Code:    api.ErrorStorageTimeout,
+			Message: "object store timed out",
+			Err:     err,
+		}
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, &api.Error{
+			Code:    api.ErrorRequestCanceled,
+			Message: "request was canceled",
+			Err:     err,
+		}
+	case minio.ToErrorResponse(err).Code == "EntityTooLarge":
+		return http.StatusRequestEntityTooLarge, &api.Error{
+			Code:    api.ErrorUploadTooLarge,
+			Message: "upload is too large for the object store",
+			Err:     err,
+		}
+	case unavailable(err):
+		return http.StatusServiceUnavailable, &api.Error{
+			Code:    api.ErrorStorageUnavailable,
+			Message: "object store is unavailable",
+			Err:     err,
+		}
+	case minio.ToErrorResponse(err).Code != "":
+		return http.StatusInternalServerError, &api.Error{
+			Code:    api.ErrorStorage,
+			Message: "object store failed",
+			Err:     err,
+		}
+	}
+	return http.StatusInternalServerError, err
+}
+
+// retryAfter returns the seconds to wait before the object store may be
+// available again.
+func retryAfter(openErr *CircuitOpenError) int {
+	return int(math.Ceil(openErr.RetryAfter.Seconds()))
+}
+
+// unavailable tells whether err means that the object store cannot be
+// reached or is overloaded.
+func unavailable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	res := minio.ToErrorResponse(err)
+	switch res.Code {
+	case "ServiceUnavailable", "SlowDown", "Throttling", "RequestLimitExceeded", "XMinioServerNotInitialized":
+		return true
+	}
+	return res.StatusCode == http.StatusServiceUnavailable
+}
+
+// fileNotFound is the response for a missing file.
+func fileNotFound(c *gin.Context, fileID string, err error) {
+	api.ErrorJSON(c, http.StatusNotFound, &api.Error{
+		Code:    api.ErrorFileNotFound,
+		Message: "file not found: " + fileID,
+		Err:     err,
+	})
+}
+
+// statFile returns the object and metadata of a file that has not
+// expired. Otherwise it writes an error response and returns false.
+func (f *FileController) statFile(c *gin.Context, fileID string) (minio.ObjectInfo, FileMeta, bool) {
+	info, err := f.ObjStore.StatObject(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+	var noSuchKeyError *NoSuchKeyError
+	if errors.As(err, &noSuchKeyError) {
+		fileNotFound(c, fileID, err)
+		return info, FileMeta{}, false
+	}
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return info, FileMeta{}, false
+	}
+	meta := f.Meta.File(fileID)
+	if expiresAt := f.expiresAt(meta, info.LastModified); expired(expiresAt, time.Now()) {
+		apiErr := &api.Error{
+			Code:    api.ErrorFileExpired,
+			Message: "file expired: " + fileID,
+		}
+		api.ErrorJSON(c, http.StatusGone, apiErr.WithDetail("expiredAt", expiresAt))
+		return info, meta, false
+	}
+	return info, meta, true
+}
+
+// fileData describes a file in responses, without its URL.
+func (f *FileController) fileData(meta FileMeta, info minio.ObjectInfo) api.ResponseFileData {
+	return api.ResponseFileData{
+		FileID:       meta.FileID,
+		LastModified: info.LastModified,
+		Size:         info.Size,
+		Name:         meta.Name,
+		CollectionID: meta.CollectionID,
+		Tags:         meta.Tags,
+		ExpiresAt:    f.expiresAt(meta, info.LastModified),
+	}
+}
+
+// parseTags parses tags given as "key=value" pairs separated by commas.
+func parseTags(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag '%s', expected key=value", pair)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// pathFileID returns the file ID of the request path. File IDs are UUIDs, any
+// other ID is rejected.
+func pathFileID(c *gin.Context) (string, bool) {
+	fileID := c.Param("fileID")
+	if id, err := uuid.Parse(fileID); err != nil || id.String() != fileID {
+		api.ErrorJSON(c, http.StatusBadRequest, &api.Error{
+			Code:    api.ErrorInvalidFileID,
+			Message: "invalid file ID: " + fileID,
+			Err:     err,
+		})
+		return "", false
+	}
+	return fileID, true
 }
 
-func NewFileController() (*FileController, error) {
-	endpoint := config.GlobalConfig.MinIOEndpoint
-	bucket := config.GlobalConfig.MinIOBucket
-	client, err := NewMinIOClient(endpoint)
-	return &FileController{Bucket: bucket, ObjStore: client}, err
+// formFile returns the uploaded file of the request, limiting the size of
+// the request body.
+func (f *FileController) formFile(c *gin.Context) (*multipart.FileHeader, bool) {
+	if maxSize := f.Upload.Load().MaxSize; maxSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	}
+	fileHeader, err := c.FormFile("file")
+	var tooLargeErr *http.MaxBytesError
+	if errors.As(err, &tooLargeErr) {
+		apiErr := &api.Error{
+			Code:    api.ErrorUploadTooLarge,
+			Message: "upload is larger than " + strconv.FormatInt(tooLargeErr.Limit, 10) + " bytes",
+			Err:     err,
+		}
+		api.ErrorJSON(c, http.StatusRequestEntityTooLarge, apiErr.WithDetail("maxSize", tooLargeErr.Limit))
+		return nil, false
+	}
+	if err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return fileHeader, true
+}
+
+// key returns the object key of a new file.
+func (f *FileController) key(fileID string) string {
+	return f.Prefix + fileID
+}
+
+// objectKey returns the object key of an existing file, which is a key of
+// its own for objects written by other tools.
+func (f *FileController) objectKey(fileID string) string {
+	if meta := f.Meta.File(fileID); meta.Key != "" {
+		return f.Prefix + meta.Key
+	}
+	return f.key(fileID)
+}
+
+// walkFiles calls fn with the metadata and object of every file, both of
+// those at their file ID and of those other tools wrote elsewhere.
+func (f *FileController) walkFiles(ctx context.Context, fn func(meta FileMeta, info minio.ObjectInfo)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, dir := range append([]string{""}, f.Meta.KeyDirs()...) {
+		objInfoChan, err := f.ObjStore.ListObjects(ctx, f.Bucket, f.Prefix+dir)
+		if err != nil {
+			return err
+		}
+		for objInfo := range objInfoChan {
+			if objInfo.Err != nil {
+				return objInfo.Err
+			}
+			// Skip nested prefixes, these hold the service's own records
+			// and the objects of other tools
+			if strings.HasSuffix(objInfo.Key, "/") {
+				continue
+			}
+			name := strings.TrimPrefix(objInfo.Key, f.Prefix)
+			meta, ok := f.Meta.FileAt(name)
+			if !ok && dir != "" {
+				continue
+			}
+			if !ok {
+				meta = f.Meta.File(name)
+			}
+			fn(meta, objInfo)
+		}
+	}
+	return nil
 }
 
 // AddFile godoc
 // @Summary Add file
+// @Description With extract, the files of an uploaded archive are added to a new collection below
+// @Description collectionID. It is called collectionName, or named after the archive and numbered if that
+// @Description name is taken, as in "models (2)". Entries outside of the archive are rejected, as are
+// @Description archives that extract to more files or bytes than the upload.extract limits allow.
 // @ID AddFile
 // @Tags files
 // @Produce json
 // @Accept multipart/form-data
 // @Success 200 {object} api.ResponseFile "File that was added"
 // @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 409 {object} api.ResponseError "A collection named collectionName exists"
+// @Failure 413 {object} api.ResponseError "Upload or extracted archive too large"
 // @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
 // @Param file formData file true "File to be uploaded"
+// @Param collectionID formData string false "ID of collection to place the file in"
+// @Param tags formData string false "Tags of the file as comma-separated key=value pairs"
+// @Param expiresAt formData string false "Time at which the file expires (RFC 3339)"
+// @Param ttl formData string false "Time to live of the file, e.g. 72h, instead of expiresAt"
+// @Param extract formData bool false "Extract the uploaded ZIP, tar or tar.gz archive into a new collection, responding with api.ResponseExtract"
+// @Param keepArchive formData bool false "Keep the archive itself as well when extracting it"
+// @Param collectionName formData string false "Name of the collection to extract the archive into"
 // @Router /files [post]
 func (f *FileController) AddFile(c *gin.Context) {
 
 	fileID := uuid.New().String()
-	fileHeader, err := c.FormFile("file")
+	fileHeader, ok := f.formFile(c)
+	if !ok {
+		return
+	}
+	collectionID := c.PostForm("collectionID")
+	if collectionID != "" {
+		if _, err := f.Meta.Collection(collectionID); err != nil {
+			api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorCollectionNotFound, err))
+			return
+		}
+	}
+	tags, err := parseTags(c.PostForm("tags"))
 	if err != nil {
-		api.ErrorJSON(c, http.StatusBadRequest, err)
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+		return
+	}
+	expiresAt, err := parseExpiry(c.PostForm("expiresAt"), c.PostForm("ttl"))
+	if err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+		return
+	}
+
+	extract, err := formBool(c, "extract")
+	if err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+		return
+	}
+	keepArchive, err := formBool(c, "keepArchive")
+	if err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+		return
+	}
+	collectionName := c.PostForm("collectionName")
+	if strings.Contains(collectionName, "/") {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest,
+			errors.New("collection name must not contain slashes")))
 		return
 	}
 
@@ -65,27 +419,126 @@ func (f *FileController) AddFile(c *gin.Context) {
 		api.ErrorJSON(c, http.StatusInternalServerError, err)
 		return
 	}
-	content.Close()
-
-	f.ObjStore.PutObject(f.Bucket, fileID, content, contentSize, contentType)
+	defer content.Close()
 
-	url, err := f.ObjStore.GetObjectUrl(f.Bucket, fileID)
+	meta := FileMeta{
+		FileID:       fileID,
+		Name:         fileHeader.Filename,
+		CollectionID: collectionID,
+		Tags:         tags,
+		ExpiresAt:    expiresAt,
+	}
+	if extract {
+		f.addArchive(c, meta, content, contentSize, contentType, collectionName, keepArchive)
+		return
+	}
+	data, err := f.putFile(c.Request.Context(), meta, content, contentSize, contentType)
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		StorageErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseFile{Data: data})
+}
+
+// addArchive extracts an uploaded archive into a new collection and keeps
+// the archive itself as the file of meta if asked to. See extractArchive
+// for collectionName.
+func (f *FileController) addArchive(c *gin.Context, meta FileMeta, content multipart.File, size int64, contentType string,
+	collectionName string, keepArchive bool) {
+	ctx := c.Request.Context()
+	format := archiveFormat(content)
+	if format == "" {
+		api.ErrorJSON(c, http.StatusBadRequest, &api.Error{
+			Code:    api.ErrorInvalidArchive,
+			Message: "upload is not a ZIP, tar or gzipped tar archive",
+		})
+		return
+	}
+	if err := f.checkArchive(format, content, size); err != nil {
+		extractErrorJSON(c, err)
 		return
 	}
-	info, err := f.ObjStore.StatObject(f.Bucket, fileID)
+
+	x, err := f.extractArchive(ctx, format, content, size, meta.Name, collectionName, meta.CollectionID, meta.Tags, meta.ExpiresAt)
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		f.discard(ctx, x)
+		extractErrorJSON(c, err)
 		return
 	}
-	c.PureJSON(http.StatusOK, api.ResponseFile{
-		Data: api.ResponseFileData{
-			FileID:       fileID,
-			LastModified: info.LastModified,
-			URL:          url.String(),
-		},
-	})
+	data := api.ResponseExtractData{CollectionID: x.collectionID, FileIDs: x.fileIDs}
+	if data.FileIDs == nil {
+		data.FileIDs = []string{}
+	}
+	if keepArchive {
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			f.discard(ctx, x)
+			api.ErrorJSON(c, http.StatusInternalServerError, err)
+			return
+		}
+		archive, err := f.putFile(ctx, meta, content, size, contentType)
+		if err != nil {
+			f.discard(ctx, x)
+			StorageErrorJSON(c, err)
+			return
+		}
+		data.Archive = &archive
+	}
+	// Consumers only learn of the files once the whole archive is extracted
+	for _, fileID := range x.fileIDs {
+		f.publish(ctx, events.FileCreated, f.Meta.File(fileID), x.sizes[fileID])
+	}
+	c.PureJSON(http.StatusOK, api.ResponseExtract{Data: data})
+}
+
+// extractErrorJSON writes the response for an error extracting an archive.
+func extractErrorJSON(c *gin.Context, err error) {
+	var apiErr *api.Error
+	var conflictError *CollectionConflictError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Code == api.ErrorArchiveTooLarge:
+		api.ErrorJSON(c, http.StatusRequestEntityTooLarge, err)
+	case errors.As(err, &apiErr):
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+	case errors.As(err, &conflictError):
+		api.ErrorJSON(c, http.StatusConflict, codedError(api.ErrorCollectionConflict, err))
+	default:
+		StorageErrorJSON(c, err)
+	}
+}
+
+// putFile uploads a file with its metadata and returns its data.
+func (f *FileController) putFile(ctx context.Context, meta FileMeta, content io.Reader, size int64, contentType string) (api.ResponseFileData, error) {
+	if err := f.ObjStore.PutObject(ctx, f.Bucket, f.key(meta.FileID), content, size, contentType); err != nil {
+		return api.ResponseFileData{}, err
+	}
+	if err := f.Meta.PutFile(ctx, meta); err != nil {
+		return api.ResponseFileData{}, err
+	}
+	url, err := f.ObjStore.GetObjectUrl(ctx, f.Bucket, f.key(meta.FileID))
+	if err != nil {
+		return api.ResponseFileData{}, err
+	}
+	info, err := f.ObjStore.StatObject(ctx, f.Bucket, f.key(meta.FileID))
+	if err != nil {
+		return api.ResponseFileData{}, err
+	}
+	f.publish(ctx, events.FileCreated, meta, info.Size)
+	data := f.fileData(meta, info)
+	data.URL = url.String()
+	return data, nil
+}
+
+// formBool returns a boolean form field, false if it is missing.
+func formBool(c *gin.Context, key string) (bool, error) {
+	value := c.PostForm(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s '%s', expected true or false", key, value)
+	}
+	return b, nil
 }
 
 // GetFile godoc
@@ -96,34 +549,30 @@ func (f *FileController) AddFile(c *gin.Context) {
 // @Success 200 {object} api.ResponseFile "File info"
 // @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "File not found"
+// @Failure 410 {object} api.ResponseError "File expired"
 // @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
 // @Param fileID path string true "ID of file"
 // @Router /files/{fileID} [get]
 func (f *FileController) GetFile(c *gin.Context) {
 
-	fileID := c.Param("fileID")
-	info, err := f.ObjStore.StatObject(f.Bucket, fileID)
-	var noSuchKeyError *NoSuchKeyError
-	if errors.As(err, &noSuchKeyError) {
-		api.ErrorJSON(c, http.StatusNotFound, err)
+	fileID, ok := pathFileID(c)
+	if !ok {
 		return
 	}
-	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+	info, meta, ok := f.statFile(c, fileID)
+	if !ok {
 		return
 	}
-	url, err := f.ObjStore.GetObjectUrl(f.Bucket, fileID)
+	url, err := f.ObjStore.GetObjectUrl(c.Request.Context(), f.Bucket, f.objectKey(fileID))
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		StorageErrorJSON(c, err)
 		return
 	}
-	c.PureJSON(http.StatusOK, api.ResponseFile{
-		Data: api.ResponseFileData{
-			FileID:       fileID,
-			LastModified: info.LastModified,
-			URL:          url.String(),
-		},
-	})
+	data := f.fileData(meta, info)
+	data.URL = url.String()
+	c.PureJSON(http.StatusOK, api.ResponseFile{Data: data})
 }
 
 // UpdateFile godoc
@@ -135,78 +584,366 @@ func (f *FileController) GetFile(c *gin.Context) {
 // @Success 200 {object} api.ResponseFile "File that was updated"
 // @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "File not found"
+// @Failure 410 {object} api.ResponseError "File expired"
+// @Failure 413 {object} api.ResponseError "Upload too large"
 // @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
 // @Param fileID path string true "ID of file"
 // @Param file formData file true "File to be uploaded"
+// @Param collectionID formData string false "ID of collection to move the file to, empty for the top level"
+// @Param tags formData string false "Tags replacing those of the file as comma-separated key=value pairs"
+// @Param expiresAt formData string false "Time at which the file expires (RFC 3339), empty to keep it"
+// @Param ttl formData string false "Time to live of the file, e.g. 72h, instead of expiresAt"
 // @Router /files/{fileID} [put]
 func (f *FileController) UpdateFile(c *gin.Context) {
 
-	fileID := c.Param("fileID")
-	fileHeader, err := c.FormFile("file")
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return
+	}
+	fileHeader, ok := f.formFile(c)
+	if !ok {
+		return
+	}
+
+	// Check if the file exists
+	_, meta, ok := f.statFile(c, fileID)
+	if !ok {
+		return
+	}
+
+	meta.Name = fileHeader.Filename
+	if collectionID, ok := c.GetPostForm("collectionID"); ok {
+		if collectionID != "" {
+			if _, err := f.Meta.Collection(collectionID); err != nil {
+				api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorCollectionNotFound, err))
+				return
+			}
+		}
+		meta.CollectionID = collectionID
+	}
+	if tags, ok := c.GetPostForm("tags"); ok {
+		var err error
+		if meta.Tags, err = parseTags(tags); err != nil {
+			api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+			return
+		}
+	}
+	expiresAt, hasExpiresAt := c.GetPostForm("expiresAt")
+	ttl, hasTTL := c.GetPostForm("ttl")
+	if hasExpiresAt || hasTTL {
+		var err error
+		if meta.ExpiresAt, err = parseExpiry(expiresAt, ttl); err != nil {
+			api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+			return
+		}
+	}
+
+	contentType := fileHeader.Header.Get("Content-Type")
+	contentSize := fileHeader.Size
+	content, err := fileHeader.Open()
+	if err != nil {
+		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer content.Close()
+
+	err = f.ObjStore.PutObject(c.Request.Context(), f.Bucket, f.objectKey(fileID), content, contentSize, contentType)
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	if err := f.Meta.PutFile(c.Request.Context(), meta); err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+
+	url, err := f.ObjStore.GetObjectUrl(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	info, err := f.ObjStore.StatObject(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	f.publish(c.Request.Context(), events.FileUpdated, meta, info.Size)
+	data := f.fileData(meta, info)
+	data.URL = url.String()
+	c.PureJSON(http.StatusOK, api.ResponseFile{Data: data})
+}
+
+// MoveFile godoc
+// @Summary Move file to another collection
+// @ID MoveFile
+// @Tags files
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.ResponseFile "File that was moved"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "File not found"
+// @Failure 410 {object} api.ResponseError "File expired"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param fileID path string true "ID of file"
+// @Param target body api.RequestMoveFile true "Collection to move the file to"
+// @Router /files/{fileID}/move [post]
+func (f *FileController) MoveFile(c *gin.Context) {
+
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return
+	}
+	var target api.RequestMoveFile
+	if err := c.ShouldBindJSON(&target); err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, meta, ok := f.statFile(c, fileID)
+	if !ok {
+		return
+	}
+
+	meta.CollectionID = target.CollectionID
+	err := f.Meta.PutFile(c.Request.Context(), meta)
+	var collectionNotFoundError *CollectionNotFoundError
+	if errors.As(err, &collectionNotFoundError) {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorCollectionNotFound, err))
+		return
+	}
 	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	f.publish(c.Request.Context(), events.FileMetadataChanged, meta, 0)
+
+	url, err := f.ObjStore.GetObjectUrl(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	data := f.fileData(meta, info)
+	data.URL = url.String()
+	c.PureJSON(http.StatusOK, api.ResponseFile{Data: data})
+}
+
+// CopyFile godoc
+// @Summary Copy file
+// @Description Copies a file on the object store to a new file ID, optionally into another project,
+// @Description without moving its content through the client. Name and tags are copied unless given.
+// @ID CopyFile
+// @Tags files
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.ResponseFile "Copy of the file"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "File or project not found"
+// @Failure 410 {object} api.ResponseError "File expired"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param fileID path string true "ID of file"
+// @Param target body api.RequestCopyFile false "Where to copy the file to and metadata of the copy"
+// @Router /files/{fileID}/copy [post]
+func (f *FileController) CopyFile(c *gin.Context) {
+
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return
+	}
+	var target api.RequestCopyFile
+	if err := c.ShouldBindJSON(&target); err != nil && !errors.Is(err, io.EOF) {
 		api.ErrorJSON(c, http.StatusBadRequest, err)
 		return
 	}
+	expiresAt, err := parseExpiry(target.ExpiresAt, target.TTL)
+	if err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+		return
+	}
 
-	// Check if the file exists
-	info, err := f.ObjStore.StatObject(f.Bucket, fileID)
+	dst := f
+	if target.ProjectID != "" {
+		if f.Projects != nil {
+			dst, ok = f.Projects(target.ProjectID)
+		}
+		if f.Projects == nil || !ok {
+			api.ErrorJSON(c, http.StatusNotFound, &api.Error{
+				Code:    api.ErrorProjectNotFound,
+				Message: "project not found: " + target.ProjectID,
+			})
+			return
+		}
+	}
+
+	_, src, ok := f.statFile(c, fileID)
+	if !ok {
+		return
+	}
+	meta := FileMeta{
+		FileID:    uuid.New().String(),
+		Name:      src.Name,
+		ExpiresAt: expiresAt,
+	}
+	if dst == f {
+		meta.CollectionID = src.CollectionID
+	}
+	if target.CollectionID != nil {
+		meta.CollectionID = *target.CollectionID
+	}
+	if target.Name != nil {
+		meta.Name = *target.Name
+	}
+	tags := src.Tags
+	if target.Tags != nil {
+		tags = target.Tags
+	}
+	if len(tags) > 0 {
+		meta.Tags = make(map[string]string, len(tags))
+		for key, value := range tags {
+			meta.Tags[key] = value
+		}
+	}
+	if meta.CollectionID != "" {
+		if _, err := dst.Meta.Collection(meta.CollectionID); err != nil {
+			api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorCollectionNotFound, err))
+			return
+		}
+	}
+
+	err = f.ObjStore.CopyObject(c.Request.Context(), f.Bucket, f.objectKey(fileID), dst.Bucket, dst.key(meta.FileID))
 	var noSuchKeyError *NoSuchKeyError
 	if errors.As(err, &noSuchKeyError) {
-		api.ErrorJSON(c, http.StatusNotFound, err)
+		fileNotFound(c, fileID, err)
 		return
 	}
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		StorageErrorJSON(c, err)
+		return
+	}
+	if err := dst.Meta.PutFile(c.Request.Context(), meta); err != nil {
+		StorageErrorJSON(c, err)
 		return
 	}
 
-	contentType := fileHeader.Header.Get("Content-Type")
-	contentSize := fileHeader.Size
-	content, err := fileHeader.Open()
+	url, err := dst.ObjStore.GetObjectUrl(c.Request.Context(), dst.Bucket, dst.key(meta.FileID))
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		StorageErrorJSON(c, err)
 		return
 	}
-	content.Close()
+	info, err := dst.ObjStore.StatObject(c.Request.Context(), dst.Bucket, dst.key(meta.FileID))
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	dst.publish(c.Request.Context(), events.FileCreated, meta, info.Size)
+	data := dst.fileData(meta, info)
+	data.URL = url.String()
+	c.PureJSON(http.StatusOK, api.ResponseFile{Data: data})
+}
 
-	f.ObjStore.PutObject(f.Bucket, fileID, content, contentSize, contentType)
+// SetExpiry godoc
+// @Summary Set or clear the expiry of a file
+// @Description Expiry rules of the service still apply to files without an expiry of their own.
+// @ID SetExpiry
+// @Tags files
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.ResponseFile "File with its new expiry"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "File not found"
+// @Failure 410 {object} api.ResponseError "File expired"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param fileID path string true "ID of file"
+// @Param expiry body api.RequestExpiry true "New expiry of the file"
+// @Router /files/{fileID}/expiry [put]
+func (f *FileController) SetExpiry(c *gin.Context) {
 
-	url, err := f.ObjStore.GetObjectUrl(f.Bucket, fileID)
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return
+	}
+	var expiry api.RequestExpiry
+	if err := c.ShouldBindJSON(&expiry); err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	expiresAt, err := parseExpiry(expiry.ExpiresAt, expiry.TTL)
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
 		return
 	}
-	info, err = f.ObjStore.StatObject(f.Bucket, fileID)
+
+	info, meta, ok := f.statFile(c, fileID)
+	if !ok {
+		return
+	}
+	meta.ExpiresAt = expiresAt
+	if err := f.Meta.PutFile(c.Request.Context(), meta); err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	f.publish(c.Request.Context(), events.FileMetadataChanged, meta, 0)
+
+	url, err := f.ObjStore.GetObjectUrl(c.Request.Context(), f.Bucket, f.objectKey(fileID))
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		StorageErrorJSON(c, err)
 		return
 	}
-	c.PureJSON(http.StatusOK, api.ResponseFile{
-		Data: api.ResponseFileData{
-			FileID:       fileID,
-			LastModified: info.LastModified,
-			URL:          url.String(),
-		},
-	})
+	data := f.fileData(meta, info)
+	data.URL = url.String()
+	c.PureJSON(http.StatusOK, api.ResponseFile{Data: data})
 }
 
 // DeleteFile godoc
 // @Summary Delete file
+// @Description Moves the file to the trash if the service keeps deleted files, otherwise deletes it permanently.
 // @ID DeleteFile
 // @Tags files
 // @Produce json
-// @Success 200 {object} api.ResponseEmpty "Succeeds whether the file exists or not"
+// @Success 200 {object} api.ResponseEmpty "File was deleted"
+// @Failure 400 {object} api.ResponseError "Invalid file ID"
+// @Failure 404 {object} api.ResponseError "File not found"
 // @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
 // @Param fileID path string true "ID of file"
 // @Router /files/{fileID} [delete]
 func (f *FileController) DeleteFile(c *gin.Context) {
 
-	err := f.ObjStore.DeleteObject(f.Bucket, c.Param("fileID"))
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return
+	}
+	_, err := f.ObjStore.StatObject(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+	var noSuchKeyError *NoSuchKeyError
+	if errors.As(err, &noSuchKeyError) {
+		fileNotFound(c, fileID, err)
+		return
+	}
+	meta := f.Meta.File(fileID)
+	if err == nil {
+		if f.TrashRetention > 0 {
+			err = f.trash(c.Request.Context(), fileID)
+		} else {
+			err = f.ObjStore.DeleteObject(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+			if err == nil {
+				err = f.Meta.DeleteFile(c.Request.Context(), fileID)
+			}
+		}
+	}
 
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		StorageErrorJSON(c, err)
 		return
 	}
+	f.publish(c.Request.Context(), events.FileDeleted, meta, 0)
 	c.PureJSON(http.StatusOK, api.ResponseEmpty{})
 }
 
@@ -216,29 +953,51 @@ func (f *FileController) DeleteFile(c *gin.Context) {
 // @Tags files
 // @Produce json
 // @Success 200 {object} api.ResponseFiles "Files available"
+// @Failure 404 {object} api.ResponseError "Collection not found"
 // @Failure 500 {object} api.ResponseFiles "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param collectionID query string false "Only list files directly inside this collection"
 // @Router /files [get]
 func (f *FileController) GetFiles(c *gin.Context) {
 
-	var files []api.ResponseFileData
+	collectionID, filter := c.GetQuery("collectionID")
+	if filter && collectionID != "" {
+		if _, err := f.Meta.Collection(collectionID); err != nil {
+			api.ErrorJSON(c, http.StatusNotFound, codedError(api.ErrorCollectionNotFound, err))
+			return
+		}
+	}
 
-	objInfoChan, err := f.ObjStore.ListObjects(f.Bucket)
+	files, err := f.listFiles(c.Request.Context(), func(meta FileMeta) bool {
+		return !filter || meta.CollectionID == collectionID
+	})
 	if err != nil {
-		api.ErrorJSON(c, http.StatusInternalServerError, err)
+		StorageErrorJSON(c, err)
 		return
 	}
-	for objInfo := range objInfoChan {
-		err := objInfo.Err
+	c.PureJSON(http.StatusOK, api.ResponseFiles{Data: files})
+}
 
-		if err != nil {
-			api.ErrorJSON(c, http.StatusInternalServerError, err)
+// listFiles lists the files in the bucket for which include returns true.
+// Expired files are left out, also before the reaper deleted them.
+func (f *FileController) listFiles(ctx context.Context, include func(meta FileMeta) bool) ([]api.ResponseFileData, error) {
+
+	var files []api.ResponseFileData
+
+	now := time.Now()
+	err := f.walkFiles(ctx, func(meta FileMeta, info minio.ObjectInfo) {
+		if !include(meta) {
 			return
-		} else {
-			files = append(files, api.ResponseFileData{
-				FileID:       objInfo.Key,
-				LastModified: objInfo.LastModified,
-			})
 		}
+		data := f.fileData(meta, info)
+		if expired(data.ExpiresAt, now) {
+			return
+		}
+		files = append(files, data)
+	})
+	if err != nil {
+		return nil, err
 	}
-	c.PureJSON(http.StatusOK, api.ResponseFiles{Data: files})
+	return files, nil
 }
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/events"
+)
+
+// publish publishes an event about a file. size is that of its content and
+// only given for created and updated files.
+func (f *FileController) publish(ctx context.Context, eventType string, meta FileMeta, size int64) {
+	if f.Events == nil {
+		return
+	}
+	e := events.New(eventType)
+	e.ProjectID = f.ProjectID
+	e.FileID = meta.FileID
+	e.Path = f.filePath(meta)
+	e.Name = meta.Name
+	e.CollectionID = meta.CollectionID
+	e.Size = size
+	// Tags are changed in place, subscribers get their own copy
+	if meta.Tags != nil {
+		e.Tags = make(map[string]string, len(meta.Tags))
+		for key, value := range meta.Tags {
+			e.Tags[key] = value
+		}
+	}
+	f.Events.Publish(ctx, e)
+}
+
+// writeEvent writes an event in the format of server-sent events. The type
+// is part of the data, so clients receive all events as messages.
+func writeEvent(w gin.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", e.ID, data)
+	return err
+}
+
+// GetFileEvents godoc
+// @Summary Stream the events of files
+// @Description Streams the events of the files as server-sent events (text/event-stream) until the
+// @Description client hangs up. Each message holds an event as JSON with its ID as the message ID.
+// @Description Clients resuming with the Last-Event-ID header (or lastEventID parameter) first get
+// @Description the events they missed. If those are no longer known, a "reset" event is sent first
+// @Description and the client should reload the files.
+// @ID GetFileEvents
+// @Tags files
+// @Produce text/event-stream
+// @Success 200 {object} events.Event "Stream of events"
+// @Failure 400 {object} api.ResponseError "Invalid filter"
+// @Param type query []string false "Only stream events of these types" collectionFormat(multi)
+// @Param prefix query string false "Only stream events of files whose path starts with this prefix"
+// @Param tag query string false "Only stream events of files with this tag, given as key=value"
+// @Param lastEventID query string false "ID of the last event received, for clients unable to set headers"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Router /files/events [get]
+func (f *FileController) GetFileEvents(c *gin.Context) {
+
+	filter := events.Filter{
+		Types:     c.QueryArray("type"),
+		ProjectID: &f.ProjectID,
+		Prefix:    c.Query("prefix"),
+		Tag:       c.Query("tag"),
+	}
+	if err := filter.Validate(); err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, codedError(api.ErrorInvalidRequest, err))
+		return
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventID")
+	}
+	watcher, missed, ok := f.Events.Watch(lastEventID)
+	defer watcher.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Keeps proxies like nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if !ok {
+		fmt.Fprint(c.Writer, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range missed {
+		if filter.Matches(e) {
+			writeEvent(c.Writer, e)
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(f.EventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, open := <-watcher.C:
+			if !open {
+				// The client fell behind, it resumes from the history
+				// when it reconnects
+				return
+			}
+			if !filter.Matches(e) {
+				continue
+			}
+			err = writeEvent(c.Writer, e)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		}
+		if err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/sogno-platform/file-service/events"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+)
+
+// parseExpiry returns the expiry given either as a point in time (RFC 3339)
+// or as a time to live from now. Without either the file is kept.
+func parseExpiry(expiresAt string, ttl string) (*time.Time, error) {
+	var t time.Time
+	switch {
+	case expiresAt != "" && ttl != "":
+		return nil, errors.New("give either expiresAt or ttl, not both")
+	case expiresAt != "":
+		var err error
+		if t, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+			return nil, fmt.Errorf("invalid expiresAt '%s', expected RFC 3339", expiresAt)
+		}
+	case ttl != "":
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl '%s', expected a duration like 72h", ttl)
+		}
+		t = time.Now().Add(d)
+	default:
+		return nil, nil
+	}
+	if !t.After(time.Now()) {
+		return nil, errors.New("expiry must be in the future")
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// expiresAt returns when a file expires: at its own expiry or when the
+// first of the matching rules lets it expire, whichever comes first. It
+// returns nil for files that are kept.
+func (f *FileController) expiresAt(meta FileMeta, lastModified time.Time) *time.Time {
+	expiresAt := meta.ExpiresAt
+	var path string
+	for _, rule := range f.ExpiryRules {
+		if rule.TagKey != "" {
+			if value, ok := meta.Tags[rule.TagKey]; !ok || value != rule.TagValue {
+				continue
+			}
+		}
+		if rule.Prefix != "" {
+			if path == "" {
+				path = f.filePath(meta)
+			}
+			if !strings.HasPrefix(path, rule.Prefix) {
+				continue
+			}
+		}
+		t := lastModified.Add(rule.After).UTC()
+		if expiresAt == nil || t.Before(*expiresAt) {
+			expiresAt = &t
+		}
+	}
+	return expiresAt
+}
+
+// filePath returns the path of a file made of its collections and name.
+func (f *FileController) filePath(meta FileMeta) string {
+	name := meta.Name
+	if name == "" {
+		name = meta.FileID
+	}
+	if collectionPath := f.Meta.CollectionPath(meta.CollectionID); collectionPath != "" {
+		return collectionPath + "/" + name
+	}
+	return name
+}
+
+func expired(expiresAt *time.Time, now time.Time) bool {
+	return expiresAt != nil && !expiresAt.After(now)
+}
+
+// Reap deletes the files that have expired and returns how many it
+// deleted. It continues with the other files if one cannot be deleted.
+func (f *FileController) Reap(ctx context.Context) (int, error) {
+	now := time.Now()
+	var expiredIDs []string
+	err := f.walkFiles(ctx, func(meta FileMeta, info minio.ObjectInfo) {
+		if expired(f.expiresAt(meta, info.LastModified), now) {
+			expiredIDs = append(expiredIDs, meta.FileID)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	reaped := 0
+	for _, fileID := range expiredIDs {
+		meta := f.Meta.File(fileID)
+		err := f.ObjStore.DeleteObject(ctx, f.Bucket, f.objectKey(fileID))
+		if err == nil {
+			err = f.Meta.DeleteFile(ctx, fileID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deleting expired file %s: %w", fileID, err))
+			continue
+		}
+		f.publish(ctx, events.FileDeleted, meta, 0)
+		reaped++
+	}
+	metrics.AddExpiredFiles(reaped)
+	return reaped, errors.Join(errs...)
+}
+
+// RunReaper deletes the expired files of all controllers every interval
+// until ctx is done.
+func RunReaper(ctx context.Context, interval time.Duration, controllers ...*FileController) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.FromContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, controller := range controllers {
+			reaped, err := controller.Reap(ctx)
+			if err != nil {
+				logger.Error("deleting expired files", "bucket", controller.Bucket, "prefix", controller.Prefix, "error", err)
+			}
+			if reaped > 0 {
+				logger.Info("deleted expired files", "bucket", controller.Bucket, "prefix", controller.Prefix, "count", reaped)
+			}
+		}
+	}
+}
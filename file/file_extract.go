@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/logging"
+)
+
+// archiveFormat detects the format of an archive by its first bytes. It
+// returns "" for other files.
+func archiveFormat(r io.ReaderAt) string {
+	head := make([]byte, 512)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return "zip"
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "tar.gz"
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return "tar"
+	}
+	return ""
+}
+
+func invalidArchive(err error) error {
+	return &api.Error{
+		Code:    api.ErrorInvalidArchive,
+		Message: "invalid archive: " + err.Error(),
+		Err:     err,
+	}
+}
+
+// errReader records the errors reading from r other than io.EOF, telling
+// them apart from the errors of whoever reads from it.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		e.err = err
+	}
+	return n, err
+}
+
+// walkArchive calls fn for the directories and regular files of an archive
+// in their order. The content of directories is nil. Other entries, e.g.
+// links, are skipped.
+func walkArchive(format string, archive multipart.File, size int64, fn func(name string, size int64, content io.Reader) error) error {
+	walkFile := func(name string, size int64, r io.Reader) error {
+		// Read errors are the archive's fault rather than the object store's
+		content := &errReader{r: r}
+		err := fn(name, size, content)
+		if content.err != nil {
+			return invalidArchive(content.err)
+		}
+		return err
+	}
+
+	if format == "zip" {
+		zr, err := zip.NewReader(archive, size)
+		if err != nil {
+			return invalidArchive(err)
+		}
+		for _, entry := range zr.File {
+			mode := entry.Mode()
+			if mode.IsDir() {
+				if err := fn(entry.Name, 0, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			if !mode.IsRegular() {
+				continue
+			}
+			// The zip reader fails on entries larger than their header says,
+			// so the sizes in the headers can be trusted
+			content, err := entry.Open()
+			if err != nil {
+				return invalidArchive(err)
+			}
+			err = walkFile(entry.Name, int64(entry.UncompressedSize64), content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var r io.Reader = archive
+	if format == "tar.gz" {
+		gz, err := gzip.NewReader(archive)
+		if err != nil {
+			return invalidArchive(err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return invalidArchive(err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = fn(header.Name, 0, nil)
+		case tar.TypeReg:
+			err = walkFile(header.Name, header.Size, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractPath returns the path of an archive entry below the extracted
+// archive, "" for its top level. Entries outside of it are rejected.
+func extractPath(name string) (string, error) {
+	p := strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(p) {
+		return "", invalidArchive(&pathError{name})
+	}
+	p = path.Clean(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", invalidArchive(&pathError{name})
+	}
+	if p == "." {
+		return "", nil
+	}
+	return p, nil
+}
+
+type pathError struct {
+	name string
+}
+
+func (e *pathError) Error() string {
+	return "entry '" + e.name + "' points outside of the archive"
+}
+
+// checkArchive verifies that the entries of an archive stay inside of it
+// and that it does not extract to more than the limits allow, before
+// anything is extracted. The total size is limited both absolutely and
+// relative to the size of the archive.
+func (f *FileController) checkArchive(format string, archive multipart.File, size int64) error {
+	settings := f.Upload.Load()
+	maxSize := settings.ExtractMaxSize
+	if ratio := settings.ExtractMaxRatio; ratio > 0 {
+		if ratioSize := int64(ratio * float64(size)); maxSize == 0 || ratioSize < maxSize {
+			maxSize = ratioSize
+		}
+	}
+
+	var total int64
+	files := 0
+	return walkArchive(format, archive, size, func(name string, entrySize int64, content io.Reader) error {
+		p, err := extractPath(name)
+		if err != nil {
+			return err
+		}
+		if content == nil {
+			return nil
+		}
+		if p == "" {
+			return invalidArchive(&pathError{name})
+		}
+		files++
+		total += entrySize
+		if settings.ExtractMaxFiles > 0 && files > settings.ExtractMaxFiles {
+			apiErr := &api.Error{
+				Code:    api.ErrorArchiveTooLarge,
+				Message: "archive contains more than " + strconv.Itoa(settings.ExtractMaxFiles) + " files",
+			}
+			return apiErr.WithDetail("maxFiles", settings.ExtractMaxFiles)
+		}
+		if maxSize > 0 && total > maxSize {
+			apiErr := &api.Error{
+				Code:    api.ErrorArchiveTooLarge,
+				Message: "archive extracts to more than " + strconv.FormatInt(maxSize, 10) + " bytes",
+			}
+			return apiErr.WithDetail("maxSize", maxSize)
+		}
+		return nil
+	})
+}
+
+// extraction is what has been created extracting an archive.
+type extraction struct {
+	collectionID  string
+	fileIDs       []string
+	collectionIDs []string
+	// Sizes of the extracted files by ID
+	sizes map[string]int64
+}
+
+// extractArchive extracts the files of an archive into a new collection,
+// with nested collections for its directories. The collection is called
+// collectionName, or if that is empty named after the archive and numbered
+// if the name is taken. The files get the given tags and expiry.
+func (f *FileController) extractArchive(ctx context.Context, format string, archive multipart.File, size int64,
+	name string, collectionName string, parentID string, tags map[string]string, expiresAt *time.Time) (extraction, error) {
+
+	x := extraction{sizes: make(map[string]int64)}
+	dirs := make(map[string]string)
+	var collection func(dir string) (string, error)
+	collection = func(dir string) (string, error) {
+		if collectionID, ok := dirs[dir]; ok {
+			return collectionID, nil
+		}
+		var created Collection
+		var err error
+		switch {
+		case dir != "":
+			parent, base := path.Split(dir)
+			var parentID string
+			if parentID, err = collection(strings.TrimSuffix(parent, "/")); err != nil {
+				return "", err
+			}
+			created, err = f.Meta.CreateCollection(ctx, base, parentID)
+		case collectionName != "":
+			created, err = f.Meta.CreateCollection(ctx, collectionName, parentID)
+		default:
+			created, err = f.Meta.CreateUniqueCollection(ctx, archiveName(name), parentID)
+		}
+		if err != nil {
+			return "", err
+		}
+		x.collectionIDs = append(x.collectionIDs, created.CollectionID)
+		dirs[dir] = created.CollectionID
+		return created.CollectionID, nil
+	}
+
+	var err error
+	if x.collectionID, err = collection(""); err != nil {
+		return x, err
+	}
+	err = walkArchive(format, archive, size, func(entryName string, entrySize int64, content io.Reader) error {
+		p, err := extractPath(entryName)
+		if err != nil {
+			return err
+		}
+		if content == nil {
+			_, err := collection(p)
+			return err
+		}
+		dir, fileName := path.Split(p)
+		collectionID, err := collection(strings.TrimSuffix(dir, "/"))
+		if err != nil {
+			return err
+		}
+
+		fileID := uuid.New().String()
+		contentType := mime.TypeByExtension(path.Ext(fileName))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if err := f.ObjStore.PutObject(ctx, f.Bucket, f.key(fileID), content, entrySize, contentType); err != nil {
+			return err
+		}
+		x.fileIDs = append(x.fileIDs, fileID)
+		x.sizes[fileID] = entrySize
+		meta := FileMeta{
+			FileID:       fileID,
+			Name:         fileName,
+			CollectionID: collectionID,
+			ExpiresAt:    expiresAt,
+		}
+		// Each file gets its own tags as they are changed in place
+		if tags != nil {
+			meta.Tags = make(map[string]string, len(tags))
+			for key, value := range tags {
+				meta.Tags[key] = value
+			}
+		}
+		return f.Meta.PutFile(ctx, meta)
+	})
+	return x, err
+}
+
+// discard deletes what a failed extraction created, as far as possible.
+func (f *FileController) discard(ctx context.Context, x extraction) {
+	ctx = context.WithoutCancel(ctx)
+	logger := logging.FromContext(ctx)
+	for _, fileID := range x.fileIDs {
+		err := f.ObjStore.DeleteObject(ctx, f.Bucket, f.key(fileID))
+		if err == nil {
+			err = f.Meta.DeleteFile(ctx, fileID)
+		}
+		if err != nil {
+			logger.Error("discarding extracted file", "file_id", fileID, "error", err)
+		}
+	}
+	// Nested collections were created after their parents
+	for i := len(x.collectionIDs) - 1; i >= 0; i-- {
+		if err := f.Meta.DeleteCollection(ctx, x.collectionIDs[i]); err != nil {
+			logger.Error("discarding extracted collection", "collection_id", x.collectionIDs[i], "error", err)
+		}
+	}
+}
+
+// archiveName returns the name of an archive without its extension.
+func archiveName(name string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	if name == "" {
+		return "archive"
+	}
+	return name
+}
@@ -0,0 +1,443 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// metaPrefix is where the service keeps its own records next to the files.
+// Files are stored at the top level, so non-recursive listings never
+// return these records as files.
+const metaPrefix = ".sogno/"
+
+type CollectionNotFoundError struct {
+	CollectionID string
+}
+
+func (e *CollectionNotFoundError) Error() string {
+	return "collection not found: " + e.CollectionID
+}
+
+type CollectionConflictError struct {
+	Message string
+}
+
+func (e *CollectionConflictError) Error() string {
+	return e.Message
+}
+
+type FileMeta struct {
+	FileID string `json:"fileID"`
+	// Original name of the uploaded file
+	Name string `json:"name,omitempty"`
+	// Collection the file is placed in, empty for the top level
+	CollectionID string            `json:"collectionID,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	// Time at which the file expires, nil to keep it
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Time at which the file was moved to the trash, nil for live files
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Key of the object below the prefix of the files, for objects other
+	// tools wrote at keys of their own. Empty for files kept at their ID.
+	Key string `json:"key,omitempty"`
+}
+
+type Collection struct {
+	CollectionID string    `json:"collectionID"`
+	Name         string    `json:"name"`
+	ParentID     string    `json:"parentID,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// MetaStore keeps file metadata and collections in memory and persists
+// every change as a JSON object in the bucket.
+type MetaStore struct {
+	objStore ObjectStore
+	bucket   string
+	prefix   string
+
+	mu          sync.RWMutex
+	files       map[string]FileMeta
+	collections map[string]Collection
+	// IDs of the files with keys of their own by key
+	keys map[string]string
+}
+
+func NewMetaStore(ctx context.Context, objStore ObjectStore, bucket string, prefix string) (*MetaStore, error) {
+	s := &MetaStore{
+		objStore:    objStore,
+		bucket:      bucket,
+		prefix:      prefix,
+		files:       make(map[string]FileMeta),
+		collections: make(map[string]Collection),
+		keys:        make(map[string]string),
+	}
+	err := s.load(ctx)
+	return s, err
+}
+
+func (s *MetaStore) fileKey(fileID string) string {
+	return s.prefix + metaPrefix + "files/" + fileID + ".json"
+}
+
+func (s *MetaStore) collectionKey(collectionID string) string {
+	return s.prefix + metaPrefix + "collections/" + collectionID + ".json"
+}
+
+func (s *MetaStore) load(ctx context.Context) error {
+	err := s.readAll(ctx, s.prefix+metaPrefix+"files/", func(dec *json.Decoder) error {
+		var meta FileMeta
+		if err := dec.Decode(&meta); err != nil {
+			return err
+		}
+		s.index(meta)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.readAll(ctx, s.prefix+metaPrefix+"collections/", func(dec *json.Decoder) error {
+		var collection Collection
+		if err := dec.Decode(&collection); err != nil {
+			return err
+		}
+		s.collections[collection.CollectionID] = collection
+		return nil
+	})
+}
+
+func (s *MetaStore) readAll(ctx context.Context, dir string, decode func(dec *json.Decoder) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objInfoChan, err := s.objStore.ListObjects(ctx, s.bucket, dir)
+	if err != nil {
+		return err
+	}
+	for objInfo := range objInfoChan {
+		if objInfo.Err != nil {
+			return objInfo.Err
+		}
+		if strings.HasSuffix(objInfo.Key, "/") {
+			continue
+		}
+		content, err := s.objStore.GetObject(ctx, s.bucket, objInfo.Key)
+		if err != nil {
+			return err
+		}
+		err = decode(json.NewDecoder(content))
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MetaStore) write(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.objStore.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), "application/json")
+}
+
+// File returns the metadata of a file. Files uploaded before the service
+// kept metadata have none and live at the top level.
+func (s *MetaStore) File(fileID string) FileMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta, ok := s.files[fileID]
+	if !ok {
+		return FileMeta{FileID: fileID}
+	}
+	return meta
+}
+
+// FileAt returns the metadata of the file kept at key, below the prefix of
+// the files, if another tool wrote it there.
+func (s *MetaStore) FileAt(key string) (FileMeta, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fileID, ok := s.keys[key]
+	if !ok {
+		return FileMeta{}, false
+	}
+	return s.files[fileID], true
+}
+
+// KeyDirs returns the directories below the prefix of the files holding
+// files that other tools wrote there, e.g. "reports/". Files at the top
+// level are not included.
+func (s *MetaStore) KeyDirs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for key := range s.keys {
+		dir, _ := path.Split(key)
+		if dir != "" && !seen[dir] {
+			dirs = append(dirs, dir)
+			seen[dir] = true
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// Lookup returns the metadata of a file and whether the service keeps any.
+func (s *MetaStore) Lookup(fileID string) (FileMeta, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta, ok := s.files[fileID]
+	return meta, ok
+}
+
+func (s *MetaStore) PutFile(ctx context.Context, meta FileMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if meta.CollectionID != "" {
+		if _, ok := s.collections[meta.CollectionID]; !ok {
+			return &CollectionNotFoundError{CollectionID: meta.CollectionID}
+		}
+	}
+	if err := s.write(ctx, s.fileKey(meta.FileID), meta); err != nil {
+		return err
+	}
+	s.unindex(meta.FileID)
+	s.index(meta)
+	return nil
+}
+
+// index adds a file. The caller must hold the write lock.
+func (s *MetaStore) index(meta FileMeta) {
+	s.files[meta.FileID] = meta
+	if meta.Key != "" {
+		s.keys[meta.Key] = meta.FileID
+	}
+}
+
+// unindex removes a file. The caller must hold the write lock.
+func (s *MetaStore) unindex(fileID string) {
+	if meta, ok := s.files[fileID]; ok && meta.Key != "" && s.keys[meta.Key] == fileID {
+		delete(s.keys, meta.Key)
+	}
+	delete(s.files, fileID)
+}
+
+func (s *MetaStore) DeleteFile(ctx context.Context, fileID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[fileID]; !ok {
+		return nil
+	}
+	if err := s.objStore.DeleteObject(ctx, s.bucket, s.fileKey(fileID)); err != nil {
+		return err
+	}
+	s.unindex(fileID)
+	return nil
+}
+
+// TrashedFiles returns the metadata of the files in the trash, most
+// recently deleted first.
+func (s *MetaStore) TrashedFiles() []FileMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var trashed []FileMeta
+	for _, meta := range s.files {
+		if meta.DeletedAt != nil {
+			trashed = append(trashed, meta)
+		}
+	}
+	sort.Slice(trashed, func(i, j int) bool {
+		return trashed[i].DeletedAt.After(*trashed[j].DeletedAt)
+	})
+	return trashed
+}
+
+func (s *MetaStore) Collection(collectionID string) (Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	collection, ok := s.collections[collectionID]
+	if !ok {
+		return collection, &CollectionNotFoundError{CollectionID: collectionID}
+	}
+	return collection, nil
+}
+
+// Collections returns the collections directly below parentID, sorted by
+// name. An empty parentID lists the top level.
+func (s *MetaStore) Collections(parentID string) ([]Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if parentID != "" {
+		if _, ok := s.collections[parentID]; !ok {
+			return nil, &CollectionNotFoundError{CollectionID: parentID}
+		}
+	}
+	var children []Collection
+	for _, collection := range s.collections {
+		if collection.ParentID == parentID {
+			children = append(children, collection)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	return children, nil
+}
+
+// CollectionPath returns the slash-separated names from the top level down
+// to the collection.
+func (s *MetaStore) CollectionPath(collectionID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+	for collectionID != "" {
+		collection := s.collections[collectionID]
+		names = append([]string{collection.Name}, names...)
+		collectionID = collection.ParentID
+	}
+	return strings.Join(names, "/")
+}
+
+func (s *MetaStore) CreateCollection(ctx context.Context, name string, parentID string) (Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createCollection(ctx, name, parentID)
+}
+
+// CreateUniqueCollection creates a collection like CreateCollection. If
+// the name is taken, a number is appended to it, as in "models (2)".
+func (s *MetaStore) CreateUniqueCollection(ctx context.Context, name string, parentID string) (Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unique := name
+	for n := 2; s.nameTaken(unique, parentID, ""); n++ {
+		unique = fmt.Sprintf("%s (%d)", name, n)
+	}
+	return s.createCollection(ctx, unique, parentID)
+}
+
+// createCollection creates a collection. The caller must hold the write
+// lock.
+func (s *MetaStore) createCollection(ctx context.Context, name string, parentID string) (Collection, error) {
+	collection := Collection{
+		CollectionID: uuid.New().String(),
+		Name:         name,
+		ParentID:     parentID,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := s.checkPlacement(collection); err != nil {
+		return collection, err
+	}
+	if err := s.write(ctx, s.collectionKey(collection.CollectionID), collection); err != nil {
+		return collection, err
+	}
+	s.collections[collection.CollectionID] = collection
+	return collection, nil
+}
+
+// UpdateCollection renames a collection and/or moves it below another
+// parent, nil to keep the current one. Files and nested collections move
+// along with it.
+func (s *MetaStore) UpdateCollection(ctx context.Context, collectionID string, name string, parentID *string) (Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[collectionID]
+	if !ok {
+		return collection, &CollectionNotFoundError{CollectionID: collectionID}
+	}
+	collection.Name = name
+	if parentID != nil {
+		collection.ParentID = *parentID
+	}
+	if err := s.checkPlacement(collection); err != nil {
+		return collection, err
+	}
+	if err := s.write(ctx, s.collectionKey(collectionID), collection); err != nil {
+		return collection, err
+	}
+	s.collections[collectionID] = collection
+	return collection, nil
+}
+
+// DeleteCollection deletes an empty collection. Files in the trash do not
+// count, they are restored to the top level if their collection is gone.
+func (s *MetaStore) DeleteCollection(ctx context.Context, collectionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[collectionID]; !ok {
+		return &CollectionNotFoundError{CollectionID: collectionID}
+	}
+	for _, collection := range s.collections {
+		if collection.ParentID == collectionID {
+			return &CollectionConflictError{Message: "collection contains other collections"}
+		}
+	}
+	for _, meta := range s.files {
+		if meta.CollectionID == collectionID && meta.DeletedAt == nil {
+			return &CollectionConflictError{Message: "collection contains files"}
+		}
+	}
+	if err := s.objStore.DeleteObject(ctx, s.bucket, s.collectionKey(collectionID)); err != nil {
+		return err
+	}
+	delete(s.collections, collectionID)
+	return nil
+}
+
+// checkPlacement verifies that the parent of a collection exists, that the
+// collection does not end up inside itself and that its name is unique
+// among its siblings. The caller must hold the write lock.
+func (s *MetaStore) checkPlacement(collection Collection) error {
+	for parentID := collection.ParentID; parentID != ""; {
+		if parentID == collection.CollectionID {
+			return &CollectionConflictError{Message: "collection cannot be moved into itself"}
+		}
+		parent, ok := s.collections[parentID]
+		if !ok {
+			return &CollectionNotFoundError{CollectionID: parentID}
+		}
+		parentID = parent.ParentID
+	}
+	if s.nameTaken(collection.Name, collection.ParentID, collection.CollectionID) {
+		return &CollectionConflictError{Message: "a collection named \"" + collection.Name + "\" already exists"}
+	}
+	return nil
+}
+
+// nameTaken tells whether a collection other than collectionID below
+// parentID is called name. The caller must hold the lock.
+func (s *MetaStore) nameTaken(name string, parentID string, collectionID string) bool {
+	for _, sibling := range s.collections {
+		if sibling.CollectionID != collectionID && sibling.ParentID == parentID && sibling.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -6,10 +6,20 @@ import (
 	"context"
 	"io"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/notification"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+	"github.com/sogno-platform/file-service/tracing"
 )
 
 type NoSuchKeyError struct {
@@ -21,62 +31,279 @@ func (e *NoSuchKeyError) Error() string {
 }
 
 type MinIOClient struct {
-	Client *minio.Client
+	Client   *minio.Client
+	Timeouts config.TimeoutSettings
+
+	endpoint   string
+	creds      *reloadableProvider
+	presignTTL atomic.Int64
 }
 
-func NewMinIOClient(endpoint string) (*MinIOClient, error) {
+func NewMinIOClient(endpoint string, storage config.StorageSettings, timeouts config.TimeoutSettings) (*MinIOClient, error) {
 
-	creds := credentials.NewChainCredentials(
-		[]credentials.Provider{
-			&credentials.EnvAWS{},
-			&credentials.FileAWSCredentials{},
-		},
-	)
+	creds := &reloadableProvider{provider: credentialProvider(endpoint, storage)}
 	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  creds,
-		Secure: false, // TODO: generate certificates and enable https
+		Creds:        credentials.New(creds),
+		Secure:       storage.Secure,
+		Region:       storage.Region,
+		BucketLookup: bucketLookup(storage.Addressing),
+		// Retries are left to ResilientStore, which knows which operations
+		// are safe to repeat
+		MaxRetries: 1,
 	})
-	return &MinIOClient{Client: client}, err
+	c := &MinIOClient{Client: client, Timeouts: timeouts, endpoint: endpoint, creds: creds}
+	c.presignTTL.Store(int64(storage.PresignTTL))
+	return c, err
+}
+
+// Reconfigure applies reloaded credentials and download URL validity.
+// Connection settings cannot change while the client is in use.
+func (c *MinIOClient) Reconfigure(storage config.StorageSettings) {
+	c.creds.set(credentialProvider(c.endpoint, storage))
+	c.presignTTL.Store(int64(storage.PresignTTL))
+}
+
+// begin starts the span of a storage operation and applies its timeout to
+// ctx. The returned function ends the span, records the metrics of the
+// operation and cancels ctx.
+func begin(ctx context.Context, operation string, timeout time.Duration, bucket string, key string) (context.Context, func(err error)) {
+	start := time.Now()
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	ctx, span := tracing.Tracer(ctx, "github.com/sogno-platform/file-service/file").Start(ctx, "s3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("s3.bucket", bucket),
+			attribute.String("s3.key", key),
+		),
+	)
+	return ctx, func(err error) {
+		result := metrics.ResultOK
+		if err != nil {
+			result = metrics.ResultError
+			if _, ok := err.(*NoSuchKeyError); ok {
+				result = metrics.ResultNotFound
+			} else {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+		}
+		duration := time.Since(start)
+		metrics.ObserveStorage(operation, duration, result)
+		logger := logging.FromContext(ctx).With(
+			"operation", operation,
+			"bucket", bucket,
+			"key", key,
+			"result", result,
+			"duration_ms", duration.Milliseconds(),
+		)
+		if result == metrics.ResultError {
+			logger.Warn("storage operation failed", "error", err)
+		} else {
+			logger.Debug("storage operation")
+		}
+		span.End()
+		cancel()
+	}
 }
 
-func (c *MinIOClient) PutObject(bucket string, key string, content io.Reader, contentSize int64, contentType string) error {
+func (c *MinIOClient) PutObject(ctx context.Context, bucket string, key string, content io.Reader, contentSize int64, contentType string) error {
 
-	_, err := c.Client.PutObject(
-		context.Background(),
+	ctx, end := begin(ctx, "PutObject", c.Timeouts.Put, bucket, key)
+	info, err := c.Client.PutObject(
+		ctx,
 		bucket,
 		key,
 		content,
 		contentSize,
-		minio.PutObjectOptions{ContentType: contentType, ContentDisposition: "filename=" + key + ".zip"},
+		minio.PutObjectOptions{ContentType: contentType},
 	)
+	end(err)
+	metrics.AddUploadedBytes(info.Size)
 	return err
 }
 
-func (c *MinIOClient) StatObject(bucket string, key string) (minio.ObjectInfo, error) {
+func (c *MinIOClient) StatObject(ctx context.Context, bucket string, key string) (minio.ObjectInfo, error) {
 
-	info, err := c.Client.StatObject(context.Background(), bucket, key, minio.StatObjectOptions{})
+	ctx, end := begin(ctx, "StatObject", c.Timeouts.Stat, bucket, key)
+	info, err := c.Client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
 
 	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
-		return info, &NoSuchKeyError{Message: err.Error()}
-	} else {
-		return info, err
+		err = &NoSuchKeyError{Message: err.Error()}
+	}
+	end(err)
+	return info, err
+}
+
+// GetObject opens an object for reading. The operation ends when the
+// returned reader is closed.
+func (c *MinIOClient) GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+
+	ctx, end := begin(ctx, "GetObject", c.Timeouts.Get, bucket, key)
+	obj, err := c.Client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err == nil {
+		// GetObject is lazy, stat the object to surface a missing key right away.
+		if _, err = obj.Stat(); err != nil {
+			obj.Close()
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				err = &NoSuchKeyError{Message: err.Error()}
+			}
+		}
+	}
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+	return &objectReader{ReadCloser: obj, end: end}, nil
+}
+
+func (c *MinIOClient) GetObjectRange(ctx context.Context, bucket string, key string, offset int64, length int64) (io.ReadCloser, error) {
+
+	ctx, end := begin(ctx, "GetObject", c.Timeouts.Get, bucket, key)
+	opts := minio.GetObjectOptions{}
+	err := opts.SetRange(offset, offset+length-1)
+	var content io.ReadCloser
+	if err == nil {
+		// Unlike Client.GetObject, this is not lazy. Stat on the lazy object
+		// would drop the range.
+		content, _, _, err = minio.Core{Client: c.Client}.GetObject(ctx, bucket, key, opts)
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			err = &NoSuchKeyError{Message: err.Error()}
+		}
+	}
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+	return &objectReader{ReadCloser: content, end: end}, nil
+}
+
+// objectReader counts the bytes downloaded from the object store and ends
+// the operation once it is closed.
+type objectReader struct {
+	io.ReadCloser
+	end func(err error)
+	err error
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	metrics.AddDownloadedBytes(int64(n))
+	if err != nil && err != io.EOF {
+		r.err = err
 	}
+	return n, err
+}
+
+func (r *objectReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.end(r.err)
+	return err
 }
 
-func (c *MinIOClient) GetObjectUrl(bucket string, key string) (*url.URL, error) {
+func (c *MinIOClient) GetObjectUrl(ctx context.Context, bucket string, key string) (*url.URL, error) {
 
-	// Generates a presigned url which expires in 7 days (max).
-	return c.Client.PresignedGetObject(context.Background(), bucket, key, time.Second*604800, make(url.Values))
+	ctx, end := begin(ctx, "PresignedGetObject", c.Timeouts.Presign, bucket, key)
+	// Generates a presigned url which expires after storage.presign_ttl (7 days by default)
+	u, err := c.Client.PresignedGetObject(ctx, bucket, key, time.Duration(c.presignTTL.Load()), make(url.Values))
+	end(err)
+	return u, err
 }
 
-func (c *MinIOClient) ListObjects(bucket string) (<-chan minio.ObjectInfo, error) {
+// ListObjects lists the objects directly below prefix. Keys of nested
+// "directories" are returned with a trailing slash. A listing that times
+// out ends with an error; once ctx is done, the listing stops.
+func (c *MinIOClient) ListObjects(ctx context.Context, bucket string, prefix string) (<-chan minio.ObjectInfo, error) {
+
+	opCtx, end := begin(ctx, "ListObjects", c.Timeouts.List, bucket, prefix)
+	objInfoChan := c.Client.ListObjects(opCtx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: false,
+	})
 
-	return c.Client.ListObjects(context.Background(), bucket, minio.ListObjectsOptions{
-		Recursive: true,
-	}), nil
+	// The listing is only complete once the channel is drained
+	observed := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(observed)
+		var err error
+		for objInfo := range objInfoChan {
+			if objInfo.Err != nil {
+				err = objInfo.Err
+			}
+			select {
+			case observed <- objInfo:
+			case <-ctx.Done():
+				// The caller is gone, don't block on it
+				end(ctx.Err())
+				return
+			}
+		}
+		// The listing may end silently when it times out
+		if err == nil && opCtx.Err() != nil {
+			err = opCtx.Err()
+			select {
+			case observed <- minio.ObjectInfo{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+		end(err)
+	}()
+	return observed, nil
 }
 
-func (c *MinIOClient) DeleteObject(bucket string, key string) error {
+// CopyObject copies an object without downloading it. Objects too large
+// for a single copy are copied in parts.
+func (c *MinIOClient) CopyObject(ctx context.Context, srcBucket string, srcKey string, dstBucket string, dstKey string) error {
 
-	return c.Client.RemoveObject(context.Background(), bucket, key, minio.RemoveObjectOptions{})
+	ctx, end := begin(ctx, "CopyObject", c.Timeouts.Put, dstBucket, dstKey)
+	dst := minio.CopyDestOptions{Bucket: dstBucket, Object: dstKey}
+	src := minio.CopySrcOptions{Bucket: srcBucket, Object: srcKey}
+	_, err := c.Client.CopyObject(ctx, dst, src)
+	// A single copy is limited to 5 GiB
+	switch minio.ToErrorResponse(err).Code {
+	case "InvalidRequest", "EntityTooLarge":
+		_, err = c.Client.ComposeObject(ctx, dst, src)
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		err = &NoSuchKeyError{Message: err.Error()}
+	}
+	end(err)
+	return err
+}
+
+func (c *MinIOClient) DeleteObject(ctx context.Context, bucket string, key string) error {
+
+	ctx, end := begin(ctx, "RemoveObject", c.Timeouts.Delete, bucket, key)
+	err := c.Client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{})
+	end(err)
+	return err
+}
+
+// ListenBucketNotification reports the objects created and removed in a
+// bucket, a MinIO extension of S3. The channel is closed once the
+// connection fails or ctx is done.
+func (c *MinIOClient) ListenBucketNotification(ctx context.Context, bucket string) <-chan notification.Info {
+	return c.Client.ListenBucketNotification(ctx, bucket, "", "", []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"})
+}
+
+// DeleteObjects deletes the objects with one request per 1000 keys.
+func (c *MinIOClient) DeleteObjects(ctx context.Context, bucket string, keys []string) map[string]error {
+
+	ctx, end := begin(ctx, "RemoveObjects", c.Timeouts.Delete, bucket, "")
+	objects := make(chan minio.ObjectInfo, len(keys))
+	for _, key := range keys {
+		objects <- minio.ObjectInfo{Key: key}
+	}
+	close(objects)
+
+	errs := make(map[string]error)
+	var err error
+	for removeErr := range c.Client.RemoveObjects(ctx, bucket, objects, minio.RemoveObjectsOptions{}) {
+		errs[removeErr.ObjectName] = removeErr.Err
+		err = removeErr.Err
+	}
+	end(err)
+	return errs
 }
@@ -0,0 +1,351 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7/pkg/notification"
+
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/events"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+)
+
+// ownChangeTTL is how long the service waits for the notification of a
+// change it made itself.
+const ownChangeTTL = 5 * time.Minute
+
+// relistenInterval is the wait before listening again after the
+// connection for bucket notifications failed.
+const relistenInterval = 5 * time.Second
+
+// BucketListener is implemented by object stores that report changes of
+// objects, also those made by other tools.
+type BucketListener interface {
+	ListenBucketNotification(ctx context.Context, bucket string) <-chan notification.Info
+}
+
+// ownChange is an object the service created or removed itself.
+type ownChange struct {
+	created bool
+	bucket  string
+	key     string
+}
+
+// TrackingStore remembers the objects the service creates and removes
+// through it, so their notifications can be told apart from those of
+// changes by other tools.
+type TrackingStore struct {
+	ObjectStore
+
+	mu sync.Mutex
+	// Number of changes not yet notified and when the last one was made
+	changes   map[ownChange]int
+	changedAt map[ownChange]time.Time
+	sweptAt   time.Time
+}
+
+func NewTrackingStore(store ObjectStore) *TrackingStore {
+	return &TrackingStore{
+		ObjectStore: store,
+		changes:     make(map[ownChange]int),
+		changedAt:   make(map[ownChange]time.Time),
+		sweptAt:     time.Now(),
+	}
+}
+
+// track records a change before it is made, as its notification may
+// arrive before the object store answers.
+func (s *TrackingStore) track(created bool, bucket string, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		change := ownChange{created: created, bucket: bucket, key: key}
+		s.changes[change]++
+		s.changedAt[change] = now
+	}
+	// Failed changes and those of the service's records are never
+	// claimed
+	if now.Sub(s.sweptAt) > ownChangeTTL {
+		for change, changedAt := range s.changedAt {
+			if now.Sub(changedAt) > ownChangeTTL {
+				delete(s.changes, change)
+				delete(s.changedAt, change)
+			}
+		}
+		s.sweptAt = now
+	}
+}
+
+// claim reports whether the service made a change itself and forgets it.
+func (s *TrackingStore) claim(created bool, bucket string, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change := ownChange{created: created, bucket: bucket, key: key}
+	if s.changes[change] == 0 {
+		return false
+	}
+	s.changes[change]--
+	if s.changes[change] == 0 {
+		delete(s.changes, change)
+		delete(s.changedAt, change)
+	}
+	return true
+}
+
+func (s *TrackingStore) PutObject(ctx context.Context, bucket string, key string, content io.Reader, contentSize int64, contentType string) error {
+	s.track(true, bucket, key)
+	return s.ObjectStore.PutObject(ctx, bucket, key, content, contentSize, contentType)
+}
+
+func (s *TrackingStore) CopyObject(ctx context.Context, srcBucket string, srcKey string, dstBucket string, dstKey string) error {
+	s.track(true, dstBucket, dstKey)
+	return s.ObjectStore.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+func (s *TrackingStore) DeleteObject(ctx context.Context, bucket string, key string) error {
+	s.track(false, bucket, key)
+	return s.ObjectStore.DeleteObject(ctx, bucket, key)
+}
+
+func (s *TrackingStore) DeleteObjects(ctx context.Context, bucket string, keys []string) map[string]error {
+	s.track(false, bucket, keys...)
+	return s.ObjectStore.DeleteObjects(ctx, bucket, keys)
+}
+
+// Reconciler applies the changes other tools make to the objects of the
+// file controllers, e.g. uploads with mc cp or presigned URLs, to the
+// metadata of the files and publishes their events.
+type Reconciler struct {
+	store *TrackingStore
+	// Prefixes below those of the controllers where objects of other
+	// tools become files
+	prefixes    []string
+	controllers []*FileController
+}
+
+// NewReconciler returns a reconciler for controllers whose object store is
+// store.
+func NewReconciler(store *TrackingStore, settings config.NotificationSettings, controllers ...*FileController) *Reconciler {
+	return &Reconciler{store: store, prefixes: settings.Prefixes, controllers: controllers}
+}
+
+// Run applies the notifications of bucket until ctx is done. Changes made
+// while the connection to the object store was down are not notified.
+func (r *Reconciler) Run(ctx context.Context, listener BucketListener, bucket string) {
+	for ctx.Err() == nil {
+		for info := range listener.ListenBucketNotification(ctx, bucket) {
+			if info.Err != nil {
+				logging.FromContext(ctx).Warn("listening to bucket notifications", "bucket", bucket, "error", info.Err)
+				continue
+			}
+			for _, record := range info.Records {
+				r.apply(ctx, record)
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(relistenInterval):
+		}
+	}
+}
+
+// controller returns the controller whose prefix is the longest one of
+// key in bucket.
+func (r *Reconciler) controller(bucket string, key string) (*FileController, bool) {
+	var found *FileController
+	for _, f := range r.controllers {
+		if f.Bucket == bucket && strings.HasPrefix(key, f.Prefix) &&
+			(found == nil || len(f.Prefix) > len(found.Prefix)) {
+			found = f
+		}
+	}
+	return found, found != nil
+}
+
+func (r *Reconciler) apply(ctx context.Context, record notification.Event) {
+	bucket := record.S3.Bucket.Name
+	// Keys are URL-encoded in notifications
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		key = record.S3.Object.Key
+	}
+	created := strings.HasPrefix(record.EventName, "s3:ObjectCreated:")
+	if !created && !strings.HasPrefix(record.EventName, "s3:ObjectRemoved:") {
+		return
+	}
+	logger := logging.FromContext(ctx).With("bucket", bucket, "key", key, "event", record.EventName)
+	if r.store.claim(created, bucket, key) {
+		return
+	}
+	f, ok := r.controller(bucket, key)
+	if !ok {
+		metrics.AddBucketNotification("ignored")
+		return
+	}
+
+	name := strings.TrimPrefix(key, f.Prefix)
+	adopted, isAdopted := f.Meta.FileAt(name)
+	switch {
+	case created && isAdopted:
+		err = f.reconcileWritten(ctx, adopted.FileID, record.S3.Object.Size)
+	case created && isFileID(name):
+		err = f.reconcileWritten(ctx, name, record.S3.Object.Size)
+	case created && r.adopts(name):
+		err = f.adopt(ctx, name, record.S3.Object.Size)
+	case !created && isAdopted:
+		err = f.reconcileRemoved(ctx, adopted.FileID)
+	case !created && isFileID(name):
+		err = f.reconcileRemoved(ctx, name)
+	case !created && strings.HasPrefix(name, metaPrefix+"trash/"):
+		err = f.reconcilePurged(ctx, strings.TrimPrefix(name, metaPrefix+"trash/"))
+	default:
+		// Records of the service, directory markers and objects outside
+		// of the prefixes
+		metrics.AddBucketNotification("ignored")
+		return
+	}
+	if err != nil {
+		logger.Error("applying bucket notification", "error", err)
+		metrics.AddBucketNotification("failed")
+		return
+	}
+	logger.Info("applied change made by another tool")
+	metrics.AddBucketNotification("applied")
+}
+
+// adopts tells whether the object at name, below the prefix of its
+// controller, becomes a file.
+func (r *Reconciler) adopts(name string) bool {
+	if strings.HasPrefix(name, metaPrefix) || strings.HasSuffix(name, "/") {
+		return false
+	}
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFileID(name string) bool {
+	id, err := uuid.Parse(name)
+	return err == nil && id.String() == name
+}
+
+// reconcileWritten applies a file written at its key. Files without
+// metadata are new, others were updated.
+func (f *FileController) reconcileWritten(ctx context.Context, fileID string, size int64) error {
+	meta, ok := f.Meta.Lookup(fileID)
+	if ok && meta.DeletedAt == nil {
+		f.publish(ctx, events.FileUpdated, meta, size)
+		return nil
+	}
+	if !ok {
+		meta = FileMeta{FileID: fileID}
+	}
+	if meta.DeletedAt != nil {
+		// The file is back, its copy in the trash is obsolete
+		if err := f.ObjStore.DeleteObject(ctx, f.Bucket, f.trashKey(fileID)); err != nil {
+			return err
+		}
+		meta.DeletedAt = nil
+	}
+	if err := f.Meta.PutFile(ctx, meta); err != nil {
+		return err
+	}
+	f.publish(ctx, events.FileCreated, meta, size)
+	return nil
+}
+
+// adopt turns an object written by another tool at a key of its own
+// choosing into a file with a new file ID. The object stays at its key, so
+// the tool can keep writing it there. The file is placed in collections
+// named after the directories of the key.
+func (f *FileController) adopt(ctx context.Context, name string, size int64) error {
+	collectionID, err := f.collectionFor(ctx, path.Dir(name))
+	if err != nil {
+		return err
+	}
+	meta := FileMeta{
+		FileID:       uuid.New().String(),
+		Name:         path.Base(name),
+		CollectionID: collectionID,
+		Key:          name,
+	}
+	if err := f.Meta.PutFile(ctx, meta); err != nil {
+		return err
+	}
+	f.publish(ctx, events.FileCreated, meta, size)
+	return nil
+}
+
+// collectionFor returns the collection at the slash-separated path dir,
+// creating the collections that are missing.
+func (f *FileController) collectionFor(ctx context.Context, dir string) (string, error) {
+	collectionID := ""
+	if dir == "." {
+		return collectionID, nil
+	}
+	for _, name := range strings.Split(dir, "/") {
+		if name == "" {
+			continue
+		}
+		children, err := f.Meta.Collections(collectionID)
+		if err != nil {
+			return "", err
+		}
+		parentID := collectionID
+		for _, child := range children {
+			if child.Name == name {
+				collectionID = child.CollectionID
+			}
+		}
+		if collectionID != parentID {
+			continue
+		}
+		created, err := f.Meta.CreateCollection(ctx, name, parentID)
+		if err != nil {
+			return "", err
+		}
+		collectionID = created.CollectionID
+	}
+	return collectionID, nil
+}
+
+// reconcileRemoved applies the removal of a live file.
+func (f *FileController) reconcileRemoved(ctx context.Context, fileID string) error {
+	meta, ok := f.Meta.Lookup(fileID)
+	if ok && meta.DeletedAt != nil {
+		// Moved to the trash, not by another tool
+		return nil
+	}
+	if !ok {
+		meta = FileMeta{FileID: fileID}
+	}
+	if err := f.Meta.DeleteFile(ctx, fileID); err != nil {
+		return err
+	}
+	f.publish(ctx, events.FileDeleted, meta, 0)
+	return nil
+}
+
+// reconcilePurged applies the removal of a file in the trash.
+func (f *FileController) reconcilePurged(ctx context.Context, fileID string) error {
+	if meta, ok := f.Meta.Lookup(fileID); ok && meta.DeletedAt != nil {
+		return f.Meta.DeleteFile(ctx, fileID)
+	}
+	return nil
+}
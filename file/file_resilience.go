@@ -0,0 +1,359 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/notification"
+
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+)
+
+type CircuitOpenError struct {
+	// When the object store will be tried again
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "object store is unavailable, not trying it for " + e.RetryAfter.Round(time.Second).String()
+}
+
+// ResilientStore retries transient failures of idempotent operations with
+// exponential backoff and stops calling the object store while it is down.
+type ResilientStore struct {
+	Store    ObjectStore
+	Settings config.ResilienceSettings
+	breaker  *circuitBreaker
+}
+
+func NewResilientStore(store ObjectStore, settings config.ResilienceSettings) *ResilientStore {
+	return &ResilientStore{
+		Store:    store,
+		Settings: settings,
+		breaker: &circuitBreaker{
+			threshold: settings.BreakerThreshold,
+			cooldown:  settings.BreakerCooldown,
+		},
+	}
+}
+
+// isTransient tells whether an operation may succeed if tried again.
+func isTransient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The operation timed out, each attempt could take as long again
+		return false
+	}
+	if unavailable(err) {
+		return true
+	}
+	res := minio.ToErrorResponse(err)
+	switch res.Code {
+	case "InternalError", "RequestTimeout":
+		return true
+	}
+	return res.StatusCode >= 500
+}
+
+// do runs op through the circuit breaker. Transient failures are retried
+// if the operation is idempotent.
+func (s *ResilientStore) do(ctx context.Context, operation string, idempotent bool, op func() error) error {
+	attempts := 1
+	if idempotent {
+		attempts = s.Settings.Attempts
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			logging.FromContext(ctx).Warn("retrying storage operation",
+				"operation", operation, "attempt", attempt+1, "error", err)
+			metrics.AddStorageRetry(operation)
+			if !s.wait(ctx, attempt) {
+				return err
+			}
+		}
+		if openErr := s.breaker.allow(); openErr != nil {
+			return openErr
+		}
+		err = op()
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the object store
+			s.breaker.abandon()
+			return err
+		}
+		transient := isTransient(ctx, err)
+		s.breaker.record(ctx, transient || errors.Is(err, context.DeadlineExceeded))
+		if !transient {
+			return err
+		}
+	}
+	return err
+}
+
+// wait sleeps before a retry for a random time up to the backoff of the
+// attempt ("full jitter"). It returns false if ctx is done first.
+func (s *ResilientStore) wait(ctx context.Context, attempt int) bool {
+	backoff := s.Settings.Backoff << uint(attempt-1)
+	if backoff > s.Settings.MaxBackoff || backoff <= 0 {
+		backoff = s.Settings.MaxBackoff
+	}
+	var delay time.Duration
+	if backoff > 0 {
+		delay = time.Duration(rand.Int63n(int64(backoff)))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// PutObject is only retried if content can be rewound.
+func (s *ResilientStore) PutObject(ctx context.Context, bucket string, key string, content io.Reader, contentSize int64, contentType string) error {
+	seeker, seekable := content.(io.Seeker)
+	first := true
+	return s.do(ctx, "PutObject", seekable, func() error {
+		if !first {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		first = false
+		return s.Store.PutObject(ctx, bucket, key, content, contentSize, contentType)
+	})
+}
+
+func (s *ResilientStore) StatObject(ctx context.Context, bucket string, key string) (minio.ObjectInfo, error) {
+	var info minio.ObjectInfo
+	err := s.do(ctx, "StatObject", true, func() error {
+		var err error
+		info, err = s.Store.StatObject(ctx, bucket, key)
+		return err
+	})
+	return info, err
+}
+
+func (s *ResilientStore) GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	var content io.ReadCloser
+	err := s.do(ctx, "GetObject", true, func() error {
+		var err error
+		content, err = s.Store.GetObject(ctx, bucket, key)
+		return err
+	})
+	return content, err
+}
+
+func (s *ResilientStore) GetObjectRange(ctx context.Context, bucket string, key string, offset int64, length int64) (io.ReadCloser, error) {
+	var content io.ReadCloser
+	err := s.do(ctx, "GetObject", true, func() error {
+		var err error
+		content, err = s.Store.GetObjectRange(ctx, bucket, key, offset, length)
+		return err
+	})
+	return content, err
+}
+
+func (s *ResilientStore) GetObjectUrl(ctx context.Context, bucket string, key string) (*url.URL, error) {
+	var u *url.URL
+	err := s.do(ctx, "PresignedGetObject", true, func() error {
+		var err error
+		u, err = s.Store.GetObjectUrl(ctx, bucket, key)
+		return err
+	})
+	return u, err
+}
+
+// ListObjects retries a listing that fails before yielding any object.
+// Later failures are passed on, as the caller has already seen a part of
+// the listing.
+func (s *ResilientStore) ListObjects(ctx context.Context, bucket string, prefix string) (<-chan minio.ObjectInfo, error) {
+	out := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(out)
+		started := false
+		err := s.do(ctx, "ListObjects", true, func() error {
+			objInfoChan, err := s.Store.ListObjects(ctx, bucket, prefix)
+			if err != nil {
+				return err
+			}
+			for objInfo := range objInfoChan {
+				if objInfo.Err != nil && !started {
+					for range objInfoChan {
+					}
+					return objInfo.Err
+				}
+				started = true
+				select {
+				case out <- objInfo:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+		if err != nil && !started {
+			select {
+			case out <- minio.ObjectInfo{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *ResilientStore) CopyObject(ctx context.Context, srcBucket string, srcKey string, dstBucket string, dstKey string) error {
+	return s.do(ctx, "CopyObject", true, func() error {
+		return s.Store.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+	})
+}
+
+func (s *ResilientStore) DeleteObject(ctx context.Context, bucket string, key string) error {
+	return s.do(ctx, "RemoveObject", true, func() error {
+		return s.Store.DeleteObject(ctx, bucket, key)
+	})
+}
+
+// DeleteObjects retries the keys that failed transiently.
+func (s *ResilientStore) DeleteObjects(ctx context.Context, bucket string, keys []string) map[string]error {
+	errs := make(map[string]error)
+	pending := keys
+	err := s.do(ctx, "RemoveObjects", true, func() error {
+		var retry []string
+		var transient error
+		for key, err := range s.Store.DeleteObjects(ctx, bucket, pending) {
+			errs[key] = err
+			if isTransient(ctx, err) {
+				retry = append(retry, key)
+				transient = err
+			}
+		}
+		for _, key := range retry {
+			delete(errs, key)
+		}
+		pending = retry
+		return transient
+	})
+	// Keys not attempted because the circuit opened or retries ran out
+	for _, key := range pending {
+		if _, ok := errs[key]; !ok && err != nil {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+// ListenBucketNotification listens with the object store if it supports
+// bucket notifications. Failed connections are not retried here.
+func (s *ResilientStore) ListenBucketNotification(ctx context.Context, bucket string) <-chan notification.Info {
+	if listener, ok := s.Store.(BucketListener); ok {
+		return listener.ListenBucketNotification(ctx, bucket)
+	}
+	infoChan := make(chan notification.Info, 1)
+	infoChan <- notification.Info{Err: errors.New("object store does not support bucket notifications")}
+	close(infoChan)
+	return infoChan
+}
+
+func (s *ResilientStore) CheckBucket(ctx context.Context, bucket string) error {
+	return s.do(ctx, "BucketExists", false, func() error {
+		return s.Store.CheckBucket(ctx, bucket)
+	})
+}
+
+const (
+	circuitClosed = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+// circuitBreaker opens after a number of consecutive failures. While open,
+// calls fail right away. After the cooldown a single trial call is let
+// through, which closes the circuit again if it succeeds.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+func (b *circuitBreaker) allow() error {
+	if b.threshold == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+			return &CircuitOpenError{RetryAfter: wait}
+		}
+		b.setState(circuitHalfOpen)
+		return nil
+	case circuitHalfOpen:
+		// The trial call is still running
+		return &CircuitOpenError{RetryAfter: time.Second}
+	}
+	return nil
+}
+
+func (b *circuitBreaker) record(ctx context.Context, failed bool) {
+	if b.threshold == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.failures = 0
+		if b.state != circuitClosed {
+			logging.FromContext(ctx).Info("object store is available again, closing circuit")
+			b.setState(circuitClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.threshold) {
+		logging.FromContext(ctx).Error("object store keeps failing, opening circuit",
+			"failures", b.failures, "cooldown", b.cooldown)
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
+
+// abandon ends a call without an outcome. If it was the trial call, the
+// next call is tried instead.
+func (b *circuitBreaker) abandon() {
+	if b.threshold == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.setState(circuitOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	metrics.SetStorageCircuitState(state)
+}
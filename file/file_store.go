@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ObjectStore holds the objects of the service. MinIOClient talks to the
+// object store, ResilientStore adds retries and circuit breaking on top.
+type ObjectStore interface {
+	PutObject(ctx context.Context, bucket string, key string, content io.Reader, contentSize int64, contentType string) error
+	StatObject(ctx context.Context, bucket string, key string) (minio.ObjectInfo, error)
+	GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error)
+	// GetObjectRange reads length bytes of an object starting at offset
+	GetObjectRange(ctx context.Context, bucket string, key string, offset int64, length int64) (io.ReadCloser, error)
+	GetObjectUrl(ctx context.Context, bucket string, key string) (*url.URL, error)
+	// ListObjects lists the objects below prefix until the channel is
+	// drained or ctx is done. Callers that stop reading early must cancel
+	// ctx.
+	ListObjects(ctx context.Context, bucket string, prefix string) (<-chan minio.ObjectInfo, error)
+	// CopyObject copies an object on the object store, also between buckets
+	CopyObject(ctx context.Context, srcBucket string, srcKey string, dstBucket string, dstKey string) error
+	DeleteObject(ctx context.Context, bucket string, key string) error
+	// DeleteObjects deletes many objects at once and returns the errors by
+	// key
+	DeleteObjects(ctx context.Context, bucket string, keys []string) map[string]error
+	CheckBucket(ctx context.Context, bucket string) error
+}
@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/events"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+)
+
+func RegisterTrashEndpoints(r *gin.RouterGroup, resolve Resolver) {
+	r.GET("", resolve.handle((*FileController).GetTrash))
+	r.DELETE("", resolve.handle((*FileController).EmptyTrash))
+	r.POST("/:fileID/restore", resolve.handle((*FileController).RestoreFile))
+	r.DELETE("/:fileID", resolve.handle((*FileController).PurgeFile))
+}
+
+// trashKey returns the object key of a file in the trash.
+func (f *FileController) trashKey(fileID string) string {
+	return f.Prefix + metaPrefix + "trash/" + fileID
+}
+
+// trash moves a file to the trash.
+func (f *FileController) trash(ctx context.Context, fileID string) error {
+	if err := f.copyToTrash(ctx, fileID); err != nil {
+		return err
+	}
+	if err := f.ObjStore.DeleteObject(ctx, f.Bucket, f.objectKey(fileID)); err != nil {
+		f.discardTrashCopy(ctx, fileID)
+		return err
+	}
+	return f.markTrashed(ctx, fileID)
+}
+
+// copyToTrash copies the object of a file to the trash. The file is moved
+// once the caller deletes its object and marks it trashed.
+func (f *FileController) copyToTrash(ctx context.Context, fileID string) error {
+	return f.ObjStore.CopyObject(ctx, f.Bucket, f.objectKey(fileID), f.Bucket, f.trashKey(fileID))
+}
+
+// markTrashed marks a file deleted once its object has been copied to the
+// trash and deleted, so a live file is never listed in the trash.
+func (f *FileController) markTrashed(ctx context.Context, fileID string) error {
+	meta := f.Meta.File(fileID)
+	now := time.Now().UTC()
+	meta.DeletedAt = &now
+	return f.Meta.PutFile(ctx, meta)
+}
+
+// discardTrashCopy removes the copy of a file whose object could not be
+// deleted. The file stays live either way.
+func (f *FileController) discardTrashCopy(ctx context.Context, fileID string) {
+	if err := f.ObjStore.DeleteObject(ctx, f.Bucket, f.trashKey(fileID)); err != nil {
+		logging.FromContext(ctx).Warn("removing copy in trash", "file_id", fileID, "error", err)
+	}
+}
+
+// purge deletes a file in the trash permanently.
+func (f *FileController) purge(ctx context.Context, fileID string) error {
+	if err := f.ObjStore.DeleteObject(ctx, f.Bucket, f.trashKey(fileID)); err != nil {
+		return err
+	}
+	return f.Meta.DeleteFile(ctx, fileID)
+}
+
+// trashedFile returns the metadata of a file in the trash. Otherwise it
+// writes an error response and returns false.
+func (f *FileController) trashedFile(c *gin.Context) (FileMeta, bool) {
+	fileID, ok := pathFileID(c)
+	if !ok {
+		return FileMeta{}, false
+	}
+	meta := f.Meta.File(fileID)
+	if meta.DeletedAt == nil {
+		api.ErrorJSON(c, http.StatusNotFound, &api.Error{
+			Code:    api.ErrorFileNotFound,
+			Message: "file not in trash: " + fileID,
+		})
+		return meta, false
+	}
+	return meta, true
+}
+
+// PurgeTrash deletes the files whose retention in the trash has passed and
+// returns how many it deleted.
+func (f *FileController) PurgeTrash(ctx context.Context) (int, error) {
+	var errs []error
+	purged := 0
+	for _, meta := range f.Meta.TrashedFiles() {
+		if time.Since(*meta.DeletedAt) < f.TrashRetention {
+			continue
+		}
+		if err := f.purge(ctx, meta.FileID); err != nil {
+			errs = append(errs, fmt.Errorf("purging file %s: %w", meta.FileID, err))
+			continue
+		}
+		purged++
+	}
+	metrics.AddPurgedFiles(purged)
+	return purged, errors.Join(errs...)
+}
+
+// RunPurger purges the trash of all controllers every interval until ctx
+// is done.
+func RunPurger(ctx context.Context, interval time.Duration, controllers ...*FileController) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.FromContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, controller := range controllers {
+			purged, err := controller.PurgeTrash(ctx)
+			if err != nil {
+				logger.Error("purging trash", "bucket", controller.Bucket, "prefix", controller.Prefix, "error", err)
+			}
+			if purged > 0 {
+				logger.Info("purged files from trash", "bucket", controller.Bucket, "prefix", controller.Prefix, "count", purged)
+			}
+		}
+	}
+}
+
+// GetTrash godoc
+// @Summary List the files in the trash
+// @ID GetTrash
+// @Tags trash
+// @Produce json
+// @Success 200 {object} api.ResponseFiles "Files in the trash, most recently deleted first"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Router /trash [get]
+func (f *FileController) GetTrash(c *gin.Context) {
+
+	// The objects in the trash were last modified when they were deleted
+	objInfos := make(map[string]minio.ObjectInfo)
+	objInfoChan, err := f.ObjStore.ListObjects(c.Request.Context(), f.Bucket, f.trashKey(""))
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	for objInfo := range objInfoChan {
+		if objInfo.Err != nil {
+			StorageErrorJSON(c, objInfo.Err)
+			return
+		}
+		objInfos[strings.TrimPrefix(objInfo.Key, f.trashKey(""))] = objInfo
+	}
+
+	files := []api.ResponseFileData{}
+	for _, meta := range f.Meta.TrashedFiles() {
+		objInfo, ok := objInfos[meta.FileID]
+		if !ok {
+			continue
+		}
+		data := f.fileData(meta, objInfo)
+		purgeAt := meta.DeletedAt.Add(f.TrashRetention)
+		data.ExpiresAt = nil
+		data.DeletedAt = meta.DeletedAt
+		data.PurgeAt = &purgeAt
+		files = append(files, data)
+	}
+	c.PureJSON(http.StatusOK, api.ResponseFiles{Data: files})
+}
+
+// RestoreFile godoc
+// @Summary Restore a file from the trash
+// @Description Files whose collection has been deleted are restored to the top level.
+// @ID RestoreFile
+// @Tags trash
+// @Produce json
+// @Success 200 {object} api.ResponseFile "File that was restored"
+// @Failure 400 {object} api.ResponseError "Invalid file ID"
+// @Failure 404 {object} api.ResponseError "File not in trash"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param fileID path string true "ID of file"
+// @Router /trash/{fileID}/restore [post]
+func (f *FileController) RestoreFile(c *gin.Context) {
+
+	meta, ok := f.trashedFile(c)
+	if !ok {
+		return
+	}
+	fileID := meta.FileID
+	err := f.ObjStore.CopyObject(c.Request.Context(), f.Bucket, f.trashKey(fileID), f.Bucket, f.objectKey(fileID))
+	var noSuchKeyError *NoSuchKeyError
+	if errors.As(err, &noSuchKeyError) {
+		fileNotFound(c, fileID, err)
+		return
+	}
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+
+	meta.DeletedAt = nil
+	if _, err := f.Meta.Collection(meta.CollectionID); meta.CollectionID != "" && err != nil {
+		meta.CollectionID = ""
+	}
+	if err := f.Meta.PutFile(c.Request.Context(), meta); err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	if err := f.ObjStore.DeleteObject(c.Request.Context(), f.Bucket, f.trashKey(fileID)); err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+
+	url, err := f.ObjStore.GetObjectUrl(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	info, err := f.ObjStore.StatObject(c.Request.Context(), f.Bucket, f.objectKey(fileID))
+	if err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	f.publish(c.Request.Context(), events.FileCreated, meta, info.Size)
+	data := f.fileData(meta, info)
+	data.URL = url.String()
+	c.PureJSON(http.StatusOK, api.ResponseFile{Data: data})
+}
+
+// PurgeFile godoc
+// @Summary Delete a file in the trash permanently
+// @ID PurgeFile
+// @Tags trash
+// @Produce json
+// @Success 200 {object} api.ResponseEmpty "File was purged"
+// @Failure 400 {object} api.ResponseError "Invalid file ID"
+// @Failure 404 {object} api.ResponseError "File not in trash"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param fileID path string true "ID of file"
+// @Router /trash/{fileID} [delete]
+func (f *FileController) PurgeFile(c *gin.Context) {
+
+	meta, ok := f.trashedFile(c)
+	if !ok {
+		return
+	}
+	if err := f.purge(c.Request.Context(), meta.FileID); err != nil {
+		StorageErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseEmpty{})
+}
+
+// EmptyTrash godoc
+// @Summary Delete all files in the trash permanently
+// @ID EmptyTrash
+// @Tags trash
+// @Produce json
+// @Success 200 {object} api.ResponseEmpty "Trash was emptied"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Router /trash [delete]
+func (f *FileController) EmptyTrash(c *gin.Context) {
+
+	for _, meta := range f.Meta.TrashedFiles() {
+		if err := f.purge(c.Request.Context(), meta.FileID); err != nil {
+			StorageErrorJSON(c, err)
+			return
+		}
+	}
+	c.PureJSON(http.StatusOK, api.ResponseEmpty{})
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sogno-platform/file-service/api"
+)
+
+// checkTimeout bounds each readiness check, so a hanging dependency marks
+// the service as not ready instead of stalling the probe.
+const checkTimeout = 2 * time.Second
+
+func RegisterHealthEndpoints(r gin.IRoutes, controller *HealthController) {
+	r.GET("/healthz", controller.GetLiveness)
+	r.GET("/readyz", controller.GetReadiness)
+}
+
+// Check reports whether a dependency of the service is usable.
+type Check func(ctx context.Context) error
+
+type HealthController struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+func NewHealthController() *HealthController {
+	return &HealthController{checks: make(map[string]Check)}
+}
+
+// AddCheck adds a dependency that must be usable for the service to be ready.
+func (h *HealthController) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// GetLiveness reports that the process is alive and serving requests.
+func (h *HealthController) GetLiveness(c *gin.Context) {
+	c.PureJSON(http.StatusOK, api.ResponseHealth{Status: api.HealthOK})
+}
+
+// GetReadiness runs all checks and fails with 503 if any of them fails.
+func (h *HealthController) GetReadiness(c *gin.Context) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	res := api.ResponseHealth{
+		Status: api.HealthOK,
+		Checks: make(map[string]api.ResponseHealthCheck),
+	}
+	var resMu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+			defer cancel()
+			err := check(ctx)
+
+			resMu.Lock()
+			defer resMu.Unlock()
+			if err != nil {
+				res.Status = api.HealthFail
+				res.Checks[name] = api.ResponseHealthCheck{Status: api.HealthFail, Error: err.Error()}
+			} else {
+				res.Checks[name] = api.ResponseHealthCheck{Status: api.HealthOK}
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if res.Status != api.HealthOK {
+		code = http.StatusServiceUnavailable
+	}
+	c.PureJSON(code, res)
+}
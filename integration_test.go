@@ -3,26 +3,63 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/notification"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/events"
+	"github.com/sogno-platform/file-service/file"
+	"github.com/sogno-platform/file-service/health"
+	"github.com/sogno-platform/file-service/routes"
+	"github.com/sogno-platform/file-service/webhook"
 )
 
 func addFileRequest(contents string) *http.Request {
+	return addFileRequestWithTags("test.csv", contents, "")
+}
+
+// addFileRequestWithTags is addFileRequest for a file with the given name
+// and comma-separated key=value tags.
+func addFileRequestWithTags(name string, contents string, tags string) *http.Request {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
-	part, _ := writer.CreateFormFile("file", "test.csv")
+	part, _ := writer.CreateFormFile("file", name)
 	io.Copy(part, bytes.NewBufferString(contents))
+	if tags != "" {
+		writer.WriteField("tags", tags)
+	}
 	writer.Close()
 
 	req, _ := http.NewRequest("POST", "/api/files", body)
@@ -30,6 +67,23 @@ func addFileRequest(contents string) *http.Request {
 	return req
 }
 
+// newTestEngine returns an engine for a copy of the global config changed
+// by configure, if not nil. The engine is closed when the test ends.
+func newTestEngine(t *testing.T, configure func(*config.Config)) *routes.Engine {
+	t.Helper()
+	config.Init()
+	conf := *config.GlobalConfig
+	if configure != nil {
+		configure(&conf)
+	}
+	engine, err := routes.NewEngine(&conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(engine.Close)
+	return engine
+}
+
 func TestAddFile(t *testing.T) {
 	router := setupRouter()
 	w := httptest.NewRecorder()
@@ -180,3 +234,1668 @@ func TestListFiles(t *testing.T) {
 	assert.Equal(t, 200, w.Code)
 	assert.True(t, len(resBody.Data) >= 1)
 }
+
+func TestCollections(t *testing.T) {
+	router := setupRouter()
+
+	// Create a collection with a nested collection
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/collections",
+		bytes.NewBufferString(`{"name": "campaign-`+time.Now().Format("150405.000000")+`"}`))
+	router.ServeHTTP(w, req)
+	var parentRes *api.ResponseCollection
+	json.Unmarshal([]byte(w.Body.String()), &parentRes)
+	assert.Equal(t, 200, w.Code)
+	parentID := parentRes.Data.CollectionID
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/collections",
+		bytes.NewBufferString(`{"name": "run-1", "parentID": "`+parentID+`"}`))
+	router.ServeHTTP(w, req)
+	var childRes *api.ResponseCollection
+	json.Unmarshal([]byte(w.Body.String()), &childRes)
+	assert.Equal(t, 200, w.Code)
+	childID := childRes.Data.CollectionID
+	assert.Equal(t, parentRes.Data.Name+"/run-1", childRes.Data.Path)
+
+	// Upload a file into the nested collection
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "test.csv")
+	io.Copy(part, bytes.NewBufferString("a|b\n1|2\n"))
+	writer.WriteField("collectionID", childID)
+	writer.Close()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/files", body)
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	router.ServeHTTP(w, req)
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, childID, addFileRes.Data.CollectionID)
+	fileID := addFileRes.Data.FileID
+
+	// Listing is not recursive
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/collections?parentID="+parentID, nil)
+	router.ServeHTTP(w, req)
+	var contentsRes *api.ResponseCollectionContents
+	json.Unmarshal([]byte(w.Body.String()), &contentsRes)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 1, len(contentsRes.Data.Collections))
+	assert.Equal(t, 0, len(contentsRes.Data.Files))
+
+	// A collection with files cannot be deleted
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/collections/"+childID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 409, w.Code)
+
+	// Move the file up and rename the nested collection
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/files/"+fileID+"/move",
+		bytes.NewBufferString(`{"collectionID": "`+parentID+`"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/collections/"+childID,
+		bytes.NewBufferString(`{"name": "run-2", "parentID": "`+parentID+`"}`))
+	router.ServeHTTP(w, req)
+	json.Unmarshal([]byte(w.Body.String()), &childRes)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, parentRes.Data.Name+"/run-2", childRes.Data.Path)
+
+	// Without parentID the collection stays where it is
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/collections/"+childID, bytes.NewBufferString(`{"name": "run-3"}`))
+	router.ServeHTTP(w, req)
+	json.Unmarshal([]byte(w.Body.String()), &childRes)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, parentRes.Data.Name+"/run-3", childRes.Data.Path)
+
+	// Names cannot contain slashes, which separate the names in paths
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/collections/"+childID, bytes.NewBufferString(`{"name": "run/4"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), api.ErrorInvalidRequest)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files?collectionID="+parentID, nil)
+	router.ServeHTTP(w, req)
+	var filesRes *api.ResponseFiles
+	json.Unmarshal([]byte(w.Body.String()), &filesRes)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 1, len(filesRes.Data))
+
+	// A collection cannot be moved into itself
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/collections/"+parentID,
+		bytes.NewBufferString(`{"name": "loop", "parentID": "`+childID+`"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 409, w.Code)
+
+	// Now the nested collection is empty
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/collections/"+childID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestProjects(t *testing.T) {
+	router := setupRouter()
+	if len(config.GlobalConfig.Projects) == 0 {
+		t.Skip("no projects configured")
+	}
+
+	// List projects
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/projects", nil)
+	router.ServeHTTP(w, req)
+	var projectsRes *api.ResponseProjects
+	json.Unmarshal([]byte(w.Body.String()), &projectsRes)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, len(config.GlobalConfig.Projects), len(projectsRes.Data))
+	projectID := projectsRes.Data[0].ProjectID
+
+	// Add a file to the project
+	w = httptest.NewRecorder()
+	req = addFileRequest("a|b\n1|2\n")
+	req.URL.Path = "/api/projects/" + projectID + "/files"
+	router.ServeHTTP(w, req)
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	assert.Equal(t, 200, w.Code)
+	fileID := addFileRes.Data.FileID
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/projects/"+projectID+"/files/"+fileID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	// The file is not visible outside of the project
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files/"+fileID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files", nil)
+	router.ServeHTTP(w, req)
+	var filesRes *api.ResponseFiles
+	json.Unmarshal([]byte(w.Body.String()), &filesRes)
+	for _, file := range filesRes.Data {
+		assert.NotEqual(t, fileID, file.FileID)
+	}
+
+	// Unknown projects are not found
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/projects/does-not-exist/files", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestHealth(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+
+	// Assert
+	var resBody *api.ResponseHealth
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, api.HealthOK, resBody.Status)
+	assert.Equal(t, api.HealthOK, resBody.Checks["bucket:"+config.GlobalConfig.MinIOBucket].Status)
+
+	client, _ := file.NewMinIOClient(config.GlobalConfig.MinIOEndpoint, config.GlobalConfig.Storage, config.GlobalConfig.Timeouts)
+	healthController := health.NewHealthController()
+	healthController.AddCheck("bucket:missing", func(ctx context.Context) error {
+		return client.CheckBucket(ctx, "missing")
+	})
+	failing := gin.New()
+	health.RegisterHealthEndpoints(failing, healthController)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	failing.ServeHTTP(w, req)
+	resBody = nil
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, api.HealthFail, resBody.Status)
+	assert.Equal(t, api.HealthFail, resBody.Checks["bucket:missing"].Status)
+}
+
+func TestMetrics(t *testing.T) {
+	router := setupRouter()
+	w := httptest.NewRecorder()
+	req := addFileRequest("a|b\n1|2\n")
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, 200, w.Code)
+	metrics := w.Body.String()
+	assert.Contains(t, metrics, `file_service_http_requests_total{method="POST",route="/api/files",status="200"}`)
+	assert.Contains(t, metrics, `file_service_storage_operations_total{operation="PutObject",result="ok"}`)
+	assert.Contains(t, metrics, "file_service_storage_uploaded_bytes_total")
+}
+
+func TestTracing(t *testing.T) {
+	// Stands in for an OTLP/HTTP collector
+	var mu sync.Mutex
+	var exported bytes.Buffer
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/v1/traces" {
+			exported.ReadFrom(r.Body)
+		}
+	}))
+	defer collector.Close()
+
+	setupRouter()
+	conf := *config.GlobalConfig
+	conf.Tracing = config.TracingSettings{
+		Exporter:    "otlp",
+		Endpoint:    strings.TrimPrefix(collector.URL, "http://"),
+		Insecure:    true,
+		SampleRatio: 1,
+	}
+	router, err := routes.NewEngine(&conf, nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/files", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	// Assert
+	router.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, exported.String(), "GET /api/files")
+	assert.Contains(t, exported.String(), "s3.ListObjects")
+}
+
+func TestEngines(t *testing.T) {
+	var mu sync.Mutex
+	var exported bytes.Buffer
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		exported.ReadFrom(r.Body)
+	}))
+	defer collector.Close()
+
+	// Engines with different configs run side by side
+	setupRouter()
+	traced := *config.GlobalConfig
+	traced.Log.Level = "debug"
+	traced.Upload.MaxSize = 16
+	traced.Tracing = config.TracingSettings{
+		Exporter:    "otlp",
+		Endpoint:    strings.TrimPrefix(collector.URL, "http://"),
+		Insecure:    true,
+		SampleRatio: 1,
+	}
+	tracedEngine, err := routes.NewEngine(&traced, nil)
+	assert.NoError(t, err)
+	plain := *config.GlobalConfig
+	plain.Log.Level = "error"
+	plainEngine, err := routes.NewEngine(&plain, nil)
+	assert.NoError(t, err)
+	defer plainEngine.Close()
+
+	w := httptest.NewRecorder()
+	tracedEngine.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	assert.Equal(t, 413, w.Code)
+	w = httptest.NewRecorder()
+	plainEngine.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	assert.Equal(t, 200, w.Code)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/collections", nil)
+	plainEngine.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	// Closing one engine leaves the other one running
+	tracedEngine.Close()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files", nil)
+	plainEngine.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, 200, w.Code)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, exported.String(), "POST /api/files")
+	assert.NotContains(t, exported.String(), "GET /api/collections")
+}
+
+func TestStorageUnavailable(t *testing.T) {
+	client, _ := file.NewMinIOClient("127.0.0.1:1", config.StorageSettings{}, config.TimeoutSettings{})
+	store := file.NewResilientStore(client, config.ResilienceSettings{
+		Attempts:         2,
+		Backoff:          time.Millisecond,
+		MaxBackoff:       time.Millisecond,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Minute,
+	})
+	// Loading the metadata fails and opens the circuit
+	controller, err := file.NewFileController(store, "sogno-platform", "", file.ControllerSettings{Upload: config.NewValue(config.UploadSettings{})})
+	assert.Error(t, err)
+
+	router := gin.New()
+	file.RegisterFileEndpoints(router.Group("/api/files"), file.StaticResolver(controller))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/files", nil)
+	router.ServeHTTP(w, req)
+
+	// Assert
+	var resBody *api.ResponseError
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+
+	assert.Equal(t, 503, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, api.ErrorStorageUnavailable, resBody.Error.ErrorCode)
+}
+
+func TestProvisionBucket(t *testing.T) {
+	// Stands in for an object store with lifecycle support
+	var lifecycleXML string
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isLifecycle := r.URL.Query()["lifecycle"]
+		switch {
+		case r.Method == "HEAD" && r.URL.Path == "/provisioned/":
+		case r.Method == "GET" && isLifecycle:
+			w.Write([]byte(lifecycleXML))
+		case r.Method == "PUT" && isLifecycle:
+			body, _ := ioutil.ReadAll(r.Body)
+			lifecycleXML = string(body)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`<Error><Code>NoSuchBucket</Code></Error>`))
+		}
+	}))
+	defer s3.Close()
+	lifecycleXML = `<LifecycleConfiguration><Rule><ID>operator-logs</ID><Status>Enabled</Status>` +
+		`<Filter><Prefix>logs/</Prefix></Filter><Expiration><Days>7</Days></Expiration></Rule>` +
+		`<Rule><ID>sogno-abort-uploads</ID><Status>Enabled</Status><Filter></Filter>` +
+		`<AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule>` +
+		`</LifecycleConfiguration>`
+
+	client, err := file.NewMinIOClient(strings.TrimPrefix(s3.URL, "http://"), config.StorageSettings{Region: "us-east-1"}, config.TimeoutSettings{})
+	assert.NoError(t, err)
+	err = client.ProvisionBucket("provisioned", config.BucketSettings{NoncurrentExpiryDays: 30, AbortUploadsDays: 7})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Contains(t, lifecycleXML, "<ID>operator-logs</ID>")
+	assert.Contains(t, lifecycleXML, "<ID>sogno-noncurrent-expiry</ID>")
+	assert.Equal(t, 1, strings.Count(lifecycleXML, "<ID>sogno-abort-uploads</ID>"))
+	assert.Contains(t, lifecycleXML, "<DaysAfterInitiation>7</DaysAfterInitiation>")
+	assert.NotContains(t, lifecycleXML, "<DaysAfterInitiation>1</DaysAfterInitiation>")
+
+	err = client.ProvisionBucket("missing", config.BucketSettings{})
+	assert.ErrorContains(t, err, "bucket.create")
+}
+
+// failingStore fails every StatObject with err, or with the error of ctx
+// once it is done.
+type failingStore struct {
+	file.ObjectStore
+	err   error
+	calls int
+}
+
+func (s *failingStore) StatObject(ctx context.Context, bucket string, key string) (minio.ObjectInfo, error) {
+	s.calls++
+	if ctx.Err() != nil {
+		return minio.ObjectInfo{}, ctx.Err()
+	}
+	return minio.ObjectInfo{}, s.err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	failing := &failingStore{err: minio.ErrorResponse{Code: "ServiceUnavailable", StatusCode: 503}}
+	store := file.NewResilientStore(failing, config.ResilienceSettings{
+		Attempts:         1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  10 * time.Millisecond,
+	})
+	var openErr *file.CircuitOpenError
+	store.StatObject(context.Background(), "sogno-platform", "a")
+	store.StatObject(context.Background(), "sogno-platform", "a")
+	_, err := store.StatObject(context.Background(), "sogno-platform", "a")
+	assert.ErrorAs(t, err, &openErr)
+
+	// A trial call whose caller is gone leaves the circuit open
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = store.StatObject(ctx, "sogno-platform", "a")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = store.StatObject(context.Background(), "sogno-platform", "a")
+	assert.NotErrorIs(t, err, context.Canceled)
+	_, err = store.StatObject(context.Background(), "sogno-platform", "a")
+	assert.ErrorAs(t, err, &openErr)
+
+	// Timeouts are not retried
+	timingOut := &failingStore{err: context.DeadlineExceeded}
+	store = file.NewResilientStore(timingOut, config.ResilienceSettings{Attempts: 3})
+	_, err = store.StatObject(context.Background(), "sogno-platform", "a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, timingOut.calls)
+}
+
+func TestRequestID(t *testing.T) {
+	router := setupRouter()
+	missingFileID := uuid.New().String()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/files/"+missingFileID, nil)
+	req.Header.Set("X-Request-ID", "test-request-id")
+	router.ServeHTTP(w, req)
+
+	// Assert
+	var resBody *api.ResponseError
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "test-request-id", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "test-request-id", resBody.Error.RequestID)
+
+	// Without an ID one is generated
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files/"+missingFileID, nil)
+	router.ServeHTTP(w, req)
+
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+	assert.Equal(t, w.Header().Get("X-Request-ID"), resBody.Error.RequestID)
+}
+
+func TestErrorCodes(t *testing.T) {
+	router := setupRouter()
+
+	// Missing file
+	missingFileID := uuid.New().String()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/files/"+missingFileID, nil)
+	router.ServeHTTP(w, req)
+
+	var resBody *api.ResponseError
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, api.ErrorFileNotFound, resBody.Error.ErrorCode)
+	assert.Equal(t, "file not found: "+missingFileID, resBody.Error.Message)
+
+	// Malformed file ID
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files/not-a-file-id", nil)
+	router.ServeHTTP(w, req)
+
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, api.ErrorInvalidFileID, resBody.Error.ErrorCode)
+
+	// Upload over the size limit
+	conf := *config.GlobalConfig
+	conf.Upload.MaxSize = 16
+	limited, err := routes.NewEngine(&conf, nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req = addFileRequest("a|b\n1|2\n")
+	limited.ServeHTTP(w, req)
+
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+	assert.Equal(t, 413, w.Code)
+	assert.Equal(t, api.ErrorUploadTooLarge, resBody.Error.ErrorCode)
+	assert.Equal(t, float64(16), resBody.Error.Details["maxSize"])
+}
+
+func TestStorageTimeouts(t *testing.T) {
+	router := setupRouter()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	var resFile *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &resFile)
+	fileID := resFile.Data.FileID
+
+	conf := *config.GlobalConfig
+	conf.Timeouts.Stat = time.Nanosecond
+	conf.Resilience.Attempts = 1
+	timingOut, err := routes.NewEngine(&conf, nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/files/"+fileID, nil)
+	timingOut.ServeHTTP(w, req)
+
+	// Assert
+	var resBody *api.ResponseError
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+	assert.Equal(t, 504, w.Code)
+	assert.Equal(t, api.ErrorStorageTimeout, resBody.Error.ErrorCode)
+
+	// The client hung up before the object store answered
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(ctx, "GET", "/api/files/"+fileID, nil)
+	router.ServeHTTP(w, req)
+	resBody = nil
+	json.Unmarshal([]byte(w.Body.String()), &resBody)
+	assert.Equal(t, 499, w.Code)
+	assert.Equal(t, api.ErrorRequestCanceled, resBody.Error.ErrorCode)
+}
+
+func TestConfigOverrides(t *testing.T) {
+	t.Setenv("SOGNO_FILE_SERVICE_LOG__LEVEL", "debug")
+	t.Setenv("SOGNO_FILE_SERVICE_TIMEOUTS__STAT", "5s")
+	c, err := config.Load()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", c.Log.Level)
+	assert.Equal(t, 5*time.Second, c.Timeouts.Stat)
+	assert.Equal(t, 15*time.Minute, c.Timeouts.Put)
+
+	// All problems are reported together
+	t.Setenv("SOGNO_FILE_SERVICE_LOG__LEVEL", "verbose")
+	t.Setenv("SOGNO_FILE_SERVICE_TIMEOUTS__STAT", "soon")
+	_, err = config.Load()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown log level 'verbose'")
+		assert.Contains(t, err.Error(), "invalid duration 'soon' for 'timeouts.stat'")
+	}
+
+	// Empty variables override the config file
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"minio_endpoint": "127.0.0.1:9000", "minio_bucket": "sogno-platform", "log": {"level": "debug"}}`), 0600)
+	t.Setenv("SOGNO_FILE_SERVICE_CONFIG", path)
+	t.Setenv("SOGNO_FILE_SERVICE_LOG__LEVEL", "")
+	t.Setenv("SOGNO_FILE_SERVICE_TIMEOUTS__STAT", "")
+	c, err = config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "info", c.Log.Level)
+
+	t.Setenv("SOGNO_FILE_SERVICE_CONFIG", "")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "'minio_endpoint' is required")
+}
+
+func TestStorageCredentials(t *testing.T) {
+	// The keys of the test config are moved into files
+	base, err := config.Load()
+	assert.NoError(t, err)
+	keys := credentials.Value{
+		AccessKeyID:     base.Storage.Credentials.AccessKey,
+		SecretAccessKey: base.Storage.Credentials.SecretKey,
+	}
+	if keys.AccessKeyID == "" {
+		keys, err = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvMinio{},
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.FileMinioClient{},
+		}).Get()
+		assert.NoError(t, err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "access_key"), []byte(keys.AccessKeyID+"\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "secret_key"), []byte(keys.SecretAccessKey+"\n"), 0600)
+	t.Setenv("SOGNO_FILE_SERVICE_STORAGE__ADDRESSING", "path")
+	t.Setenv("SOGNO_FILE_SERVICE_STORAGE__CREDENTIALS__ACCESS_KEY_FILE", filepath.Join(dir, "access_key"))
+	t.Setenv("SOGNO_FILE_SERVICE_STORAGE__CREDENTIALS__SECRET_KEY_FILE", filepath.Join(dir, "secret_key"))
+	c, err := config.Load()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, keys.AccessKeyID, c.Storage.Credentials.AccessKey)
+	assert.Equal(t, keys.SecretAccessKey, c.Storage.Credentials.SecretKey)
+
+	client, err := file.NewMinIOClient(c.MinIOEndpoint, c.Storage, c.Timeouts)
+	assert.NoError(t, err)
+	assert.NoError(t, client.CheckBucket(context.Background(), c.MinIOBucket))
+}
+
+func TestConfigReload(t *testing.T) {
+	router := setupRouter()
+	loaded := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = loaded })
+	conf := *config.GlobalConfig
+	custom, err := routes.NewEngine(&conf, nil)
+	assert.NoError(t, err)
+	t.Setenv("SOGNO_FILE_SERVICE_CORS__ORIGINS", "https://sogno.example.com")
+	t.Setenv("SOGNO_FILE_SERVICE_UPLOAD__MAX_SIZE", "16")
+	assert.NoError(t, config.Reload())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/api/files", nil)
+	req.Header.Set("Origin", "https://sogno.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, 204, w.Code)
+	assert.Equal(t, "https://sogno.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	assert.Equal(t, 413, w.Code)
+
+	// Engines built from another config keep their settings
+	w = httptest.NewRecorder()
+	custom.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	assert.Equal(t, 200, w.Code)
+
+	// Invalid configs are rejected
+	t.Setenv("SOGNO_FILE_SERVICE_UPLOAD__MAX_SIZE", "-1")
+	assert.Error(t, config.Reload())
+	assert.Equal(t, int64(16), config.GlobalConfig.Upload.MaxSize)
+}
+
+func TestExpiry(t *testing.T) {
+	setupRouter()
+	conf := *config.GlobalConfig
+	conf.Expiry = config.ExpirySettings{
+		Rules: []config.ExpiryRule{{ID: "scratch", TagKey: "retention", TagValue: "scratch", After: time.Millisecond}},
+	}
+	router, err := routes.NewEngine(&conf, nil)
+	assert.NoError(t, err)
+
+	addFile := func(fields map[string]string) *api.ResponseFile {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "test.csv")
+		io.Copy(part, bytes.NewBufferString("a|b\n1|2\n"))
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/api/files", body)
+		req.Header.Add("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+		var res *api.ResponseFile
+		json.Unmarshal([]byte(w.Body.String()), &res)
+		return res
+	}
+	getFile := func(fileID string) (int, *api.ResponseError) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/files/"+fileID, nil)
+		router.ServeHTTP(w, req)
+		var res *api.ResponseError
+		json.Unmarshal([]byte(w.Body.String()), &res)
+		return w.Code, res
+	}
+
+	// A file with a time to live expires on its own
+	shortLived := addFile(map[string]string{"ttl": "1s"})
+	assert.NotNil(t, shortLived.Data.ExpiresAt)
+	kept := addFile(map[string]string{"ttl": "1h"})
+
+	// Its expiry can be cleared
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/files/"+kept.Data.FileID+"/expiry", bytes.NewBufferString(`{}`))
+	router.ServeHTTP(w, req)
+	var keptRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &keptRes)
+	assert.Equal(t, 200, w.Code)
+	assert.Nil(t, keptRes.Data.ExpiresAt)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/files/"+kept.Data.FileID+"/expiry", bytes.NewBufferString(`{"ttl": "-1h"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	// Tagged files expire by rule
+	scratch := addFile(map[string]string{"tags": "retention=scratch"})
+	assert.Equal(t, "scratch", scratch.Data.Tags["retention"])
+	code, res := getFile(scratch.Data.FileID)
+	assert.Equal(t, 410, code)
+	assert.Equal(t, api.ErrorFileExpired, res.Error.ErrorCode)
+
+	time.Sleep(1100 * time.Millisecond)
+	code, _ = getFile(shortLived.Data.FileID)
+	assert.Equal(t, 410, code)
+	code, _ = getFile(kept.Data.FileID)
+	assert.Equal(t, 200, code)
+
+	// Expired files are not listed
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files", nil)
+	router.ServeHTTP(w, req)
+	var filesRes *api.ResponseFiles
+	json.Unmarshal([]byte(w.Body.String()), &filesRes)
+	for _, file := range filesRes.Data {
+		assert.NotEqual(t, shortLived.Data.FileID, file.FileID)
+		assert.NotEqual(t, scratch.Data.FileID, file.FileID)
+	}
+
+	// The reaper deletes them
+	client, err := file.NewMinIOClient(conf.MinIOEndpoint, conf.Storage, conf.Timeouts)
+	assert.NoError(t, err)
+	controller, err := file.NewFileController(client, conf.MinIOBucket, "", file.ControllerSettings{
+		Upload:      config.NewValue(conf.Upload),
+		ExpiryRules: conf.Expiry.Rules,
+	})
+	assert.NoError(t, err)
+	reaped, err := controller.Reap(context.Background())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, reaped, 2)
+	code, _ = getFile(shortLived.Data.FileID)
+	assert.Equal(t, 404, code)
+	code, _ = getFile(kept.Data.FileID)
+	assert.Equal(t, 200, code)
+}
+
+func TestTrash(t *testing.T) {
+	setupRouter()
+	conf := *config.GlobalConfig
+	conf.Expiry.ReapInterval = 0
+	conf.Trash.Retention = time.Hour
+	router, err := routes.NewEngine(&conf, nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	fileID := addFileRes.Data.FileID
+
+	serve := func(method string, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	trashed := func() bool {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/trash", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+		var trashRes *api.ResponseFiles
+		json.Unmarshal([]byte(w.Body.String()), &trashRes)
+		for _, file := range trashRes.Data {
+			if file.FileID == fileID {
+				assert.NotNil(t, file.DeletedAt)
+				assert.NotNil(t, file.PurgeAt)
+				return true
+			}
+		}
+		return false
+	}
+
+	// Deleted files go to the trash
+	assert.Equal(t, 200, serve("DELETE", "/api/files/"+fileID))
+	assert.Equal(t, 404, serve("GET", "/api/files/"+fileID))
+	assert.True(t, trashed())
+
+	// and can be restored from there
+	assert.Equal(t, 200, serve("POST", "/api/trash/"+fileID+"/restore"))
+	assert.Equal(t, 200, serve("GET", "/api/files/"+fileID))
+	assert.False(t, trashed())
+
+	// or purged
+	assert.Equal(t, 200, serve("DELETE", "/api/files/"+fileID))
+	assert.Equal(t, 200, serve("DELETE", "/api/trash/"+fileID))
+	assert.False(t, trashed())
+	assert.Equal(t, 404, serve("POST", "/api/trash/"+fileID+"/restore"))
+
+	// Missing files cannot be deleted
+	assert.Equal(t, 404, serve("DELETE", "/api/files/"+fileID))
+
+	// The trash is purged without the reaper
+	conf.Trash = config.TrashSettings{Retention: 200 * time.Millisecond, PurgeInterval: 10 * time.Millisecond}
+	purging, err := routes.NewEngine(&conf, nil)
+	assert.NoError(t, err)
+	defer purging.Close()
+	w = httptest.NewRecorder()
+	purging.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	fileID = addFileRes.Data.FileID
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/api/files/"+fileID, nil)
+	purging.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/trash", nil)
+	purging.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), fileID)
+	assert.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/trash", nil)
+		purging.ServeHTTP(w, req)
+		return w.Code == 200 && !strings.Contains(w.Body.String(), fileID)
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Files whose object cannot be deleted stay live
+	client, err := file.NewMinIOClient(conf.MinIOEndpoint, conf.Storage, conf.Timeouts)
+	assert.NoError(t, err)
+	conf.Trash.Retention = time.Hour
+	undeletable, err := routes.NewEngine(&conf, &undeletableStore{ObjectStore: client})
+	assert.NoError(t, err)
+	defer undeletable.Close()
+	w = httptest.NewRecorder()
+	undeletable.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	fileID = addFileRes.Data.FileID
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/files/"+fileID, nil)
+	undeletable.ServeHTTP(w, req)
+	assert.Equal(t, 503, w.Code)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/trash", nil)
+	undeletable.ServeHTTP(w, req)
+	assert.NotContains(t, w.Body.String(), fileID)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files/"+fileID, nil)
+	undeletable.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+}
+
+// undeletableStore fails to delete the live objects of files.
+type undeletableStore struct {
+	file.ObjectStore
+}
+
+func (s *undeletableStore) DeleteObject(ctx context.Context, bucket string, key string) error {
+	if !strings.Contains(key, "/") {
+		return minio.ErrorResponse{Code: "ServiceUnavailable", StatusCode: 503}
+	}
+	return s.ObjectStore.DeleteObject(ctx, bucket, key)
+}
+
+func TestBulkFiles(t *testing.T) {
+	router := setupRouter()
+
+	var fileIDs []string
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+		var addFileRes *api.ResponseFile
+		json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+		fileIDs = append(fileIDs, addFileRes.Data.FileID)
+	}
+	bulk := func(body string, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/files/bulk", bytes.NewBufferString(body))
+		req.Header.Set("Accept", accept)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	ids, _ := json.Marshal(fileIDs)
+
+	// Tag the files, reporting missing ones
+	missingFileID := uuid.New().String()
+	w := bulk(`{"operation": "tag", "tags": {"campaign": "`+missingFileID+`"}, "fileIDs": `+
+		string(ids[:len(ids)-1])+`, "`+missingFileID+`", "not-a-file-id"]}`, "application/json")
+	var bulkRes *api.ResponseBulk
+	json.Unmarshal([]byte(w.Body.String()), &bulkRes)
+	assert.Equal(t, 200, w.Code)
+	codes := make(map[string]int)
+	for _, result := range bulkRes.Data {
+		codes[result.FileID] = result.Code
+	}
+	assert.Equal(t, 200, codes[fileIDs[0]])
+	assert.Equal(t, 404, codes[missingFileID])
+	assert.Equal(t, 400, codes["not-a-file-id"])
+
+	// Delete them by tag, streaming the results
+	w = bulk(`{"operation": "delete", "filter": {"tag": "campaign=`+missingFileID+`"}}`, "application/x-ndjson")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Equal(t, len(fileIDs), len(lines))
+	for _, line := range lines {
+		var result api.ResponseBulkResult
+		assert.NoError(t, json.Unmarshal([]byte(line), &result))
+		assert.Equal(t, 200, result.Code)
+	}
+	for _, fileID := range fileIDs {
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/files/"+fileID, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 404, w.Code)
+	}
+
+	// Either IDs or a filter must be given
+	w = bulk(`{"operation": "delete"}`, "application/json")
+	assert.Equal(t, 400, w.Code)
+	w = bulk(`{"operation": "rename", "fileIDs": `+string(ids)+`}`, "application/json")
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestCopyFile(t *testing.T) {
+	router := setupRouter()
+	origFileContents := "a|b\n1|2\n"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequest(origFileContents))
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	fileID := addFileRes.Data.FileID
+
+	copyFile := func(body string) (int, *api.ResponseFile) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/files/"+fileID+"/copy", bytes.NewBufferString(body))
+		router.ServeHTTP(w, req)
+		var res *api.ResponseFile
+		json.Unmarshal([]byte(w.Body.String()), &res)
+		return w.Code, res
+	}
+
+	// The copy has its own ID and the same content and name
+	code, copyRes := copyFile("")
+	assert.Equal(t, 200, code)
+	assert.NotEqual(t, fileID, copyRes.Data.FileID)
+	assert.Equal(t, "test.csv", copyRes.Data.Name)
+	res, _ := http.Get(copyRes.Data.URL)
+	actualFileContents, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, origFileContents, string(actualFileContents))
+
+	// Metadata can be overridden
+	code, copyRes = copyFile(`{"name": "scenario-b.csv", "tags": {"scenario": "b"}}`)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "scenario-b.csv", copyRes.Data.Name)
+	assert.Equal(t, "b", copyRes.Data.Tags["scenario"])
+
+	// Files can be copied into projects
+	for projectID := range config.GlobalConfig.Projects {
+		code, copyRes = copyFile(`{"projectID": "` + projectID + `"}`)
+		assert.Equal(t, 200, code)
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/projects/"+projectID+"/files/"+copyRes.Data.FileID, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+		break
+	}
+	code, _ = copyFile(`{"projectID": "does-not-exist"}`)
+	assert.Equal(t, 404, code)
+}
+
+func TestDownloadFiles(t *testing.T) {
+	router := setupRouter()
+	contents := []string{"a|b\n1|2\n", "c|d\n3|4\n"}
+	var fileIDs []string
+	for _, content := range contents {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, addFileRequest(content))
+		var addFileRes *api.ResponseFile
+		json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+		fileIDs = append(fileIDs, addFileRes.Data.FileID)
+	}
+	ids, _ := json.Marshal(fileIDs)
+	download := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/files/download", bytes.NewBufferString(body))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Both files are named test.csv, the second one gets its ID as prefix
+	w := download(`{"fileIDs": ` + string(ids) + `}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(archive.File)) {
+		assert.Equal(t, "test.csv", archive.File[0].Name)
+		assert.Equal(t, fileIDs[1]+"-test.csv", archive.File[1].Name)
+		for i, entry := range archive.File {
+			r, _ := entry.Open()
+			content, _ := ioutil.ReadAll(r)
+			r.Close()
+			assert.Equal(t, contents[i], string(content))
+		}
+	}
+
+	w = download(`{"format": "tar.gz", "fileIDs": ` + string(ids) + `}`)
+	assert.Equal(t, 200, w.Code)
+	gz, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	for i := range contents {
+		header, err := tr.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(contents[i])), header.Size)
+	}
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+
+	w = download(`{"fileIDs": ["` + uuid.New().String() + `"]}`)
+	assert.Equal(t, 404, w.Code)
+	w = download(`{"format": "rar", "fileIDs": ` + string(ids) + `}`)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestExtractArchive(t *testing.T) {
+	router := setupRouter()
+	upload := func(name string, archive []byte, fields map[string]string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(archive)
+		for key, value := range fields {
+			writer.WriteField(key, value)
+		}
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/api/files", body)
+		req.Header.Add("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	zipOf := func(entries map[string]string) []byte {
+		buf := &bytes.Buffer{}
+		zw := zip.NewWriter(buf)
+		for name, content := range entries {
+			w, _ := zw.Create(name)
+			w.Write([]byte(content))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	// A model set with a profile in a subdirectory, keeping the archive
+	modelSet := zipOf(map[string]string{"EQ.xml": "<eq/>", "profiles/TP.xml": "<tp/>"})
+	name := "model-" + uuid.New().String() + ".zip"
+	w := upload(name, modelSet, map[string]string{"extract": "true", "keepArchive": "true", "tags": "grid=cigre"})
+	assert.Equal(t, 200, w.Code)
+	var extractRes *api.ResponseExtract
+	json.Unmarshal([]byte(w.Body.String()), &extractRes)
+	assert.Equal(t, 2, len(extractRes.Data.FileIDs))
+	if assert.NotNil(t, extractRes.Data.Archive) {
+		assert.Equal(t, name, extractRes.Data.Archive.Name)
+		assert.Equal(t, int64(len(modelSet)), extractRes.Data.Archive.Size)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/collections/"+extractRes.Data.CollectionID, nil)
+	router.ServeHTTP(w, req)
+	var collectionRes *api.ResponseCollection
+	json.Unmarshal([]byte(w.Body.String()), &collectionRes)
+	assert.Equal(t, strings.TrimSuffix(name, ".zip"), collectionRes.Data.Name)
+
+	paths := make(map[string]string)
+	for _, fileID := range extractRes.Data.FileIDs {
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/files/"+fileID, nil)
+		router.ServeHTTP(w, req)
+		var fileRes *api.ResponseFile
+		json.Unmarshal([]byte(w.Body.String()), &fileRes)
+		assert.Equal(t, map[string]string{"grid": "cigre"}, fileRes.Data.Tags)
+		res, err := http.Get(fileRes.Data.URL)
+		if assert.NoError(t, err) {
+			content, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			paths[fileRes.Data.Name] = string(content)
+		}
+	}
+	assert.Equal(t, map[string]string{"EQ.xml": "<eq/>", "TP.xml": "<tp/>"}, paths)
+
+	// Extracting the same archive again numbers the collection
+	collectionName := func(w *httptest.ResponseRecorder) string {
+		var extractRes *api.ResponseExtract
+		json.Unmarshal([]byte(w.Body.String()), &extractRes)
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/collections/"+extractRes.Data.CollectionID, nil)
+		router.ServeHTTP(w, req)
+		var collectionRes *api.ResponseCollection
+		json.Unmarshal([]byte(w.Body.String()), &collectionRes)
+		return collectionRes.Data.Name
+	}
+	w = upload(name, modelSet, map[string]string{"extract": "true"})
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, strings.TrimSuffix(name, ".zip")+" (2)", collectionName(w))
+
+	// The caller can name the collection, but not after an existing one
+	custom := "models-" + uuid.New().String()
+	w = upload(name, modelSet, map[string]string{"extract": "true", "collectionName": custom})
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, custom, collectionName(w))
+	w = upload(name, modelSet, map[string]string{"extract": "true", "collectionName": custom})
+	assert.Equal(t, 409, w.Code)
+	w = upload(name, modelSet, map[string]string{"extract": "true", "collectionName": "a/b"})
+	assert.Equal(t, 400, w.Code)
+
+	// A tar.gz with an entry leaving the archive
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "../../etc/passwd", Size: 4, Mode: 0644})
+	tw.Write([]byte("root"))
+	tw.Close()
+	gz.Close()
+	w = upload("evil.tar.gz", buf.Bytes(), map[string]string{"extract": "true"})
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_archive")
+
+	// A zip bomb that compresses far better than the allowed ratio
+	bomb := zipOf(map[string]string{"zeros": strings.Repeat("0", 1<<20)})
+	w = upload("bomb.zip", bomb, map[string]string{"extract": "true"})
+	assert.Equal(t, 413, w.Code)
+	assert.Contains(t, w.Body.String(), "archive_too_large")
+
+	w = upload("test.csv", []byte("a|b\n1|2\n"), map[string]string{"extract": "true"})
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestArchiveEntries(t *testing.T) {
+	router := setupRouter()
+	upload := func(name string, archive []byte) string {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(archive)
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/api/files", body)
+		req.Header.Add("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var addFileRes *api.ResponseFile
+		json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+		return addFileRes.Data.FileID
+	}
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	profile := strings.Repeat("<cim:ACLineSegment/>\n", 1000)
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, _ := zw.Create("EQ.xml")
+	w.Write([]byte("<eq/>"))
+	w, _ = zw.CreateHeader(&zip.FileHeader{Name: "profiles/TP.xml", Method: zip.Deflate})
+	w.Write([]byte(profile))
+	w, _ = zw.CreateHeader(&zip.FileHeader{Name: "SV.xml", Method: zip.Store})
+	w.Write([]byte("<sv/>"))
+	zw.Close()
+	zipID := upload("model.zip", buf.Bytes())
+
+	res := get("/api/files/" + zipID + "/archive")
+	assert.Equal(t, 200, res.Code)
+	var entriesRes *api.ResponseArchiveEntries
+	json.Unmarshal([]byte(res.Body.String()), &entriesRes)
+	if assert.Equal(t, 3, len(entriesRes.Data)) {
+		assert.Equal(t, "profiles/TP.xml", entriesRes.Data[1].Path)
+		assert.Equal(t, int64(len(profile)), entriesRes.Data[1].Size)
+	}
+	res = get("/api/files/" + zipID + "/archive/profiles/TP.xml")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, profile, res.Body.String())
+	res = get("/api/files/" + zipID + "/archive/SV.xml")
+	assert.Equal(t, "<sv/>", res.Body.String())
+	res = get("/api/files/" + zipID + "/archive/SSH.xml")
+	assert.Equal(t, 404, res.Code)
+	assert.Contains(t, res.Body.String(), "entry_not_found")
+
+	buf = &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "profiles/", Mode: 0755})
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "profiles/TP.xml", Size: int64(len(profile)), Mode: 0644})
+	tw.Write([]byte(profile))
+	tw.Close()
+	gz.Close()
+	tarID := upload("model.tar.gz", buf.Bytes())
+
+	res = get("/api/files/" + tarID + "/archive")
+	json.Unmarshal([]byte(res.Body.String()), &entriesRes)
+	if assert.Equal(t, 1, len(entriesRes.Data)) {
+		assert.Equal(t, "profiles/TP.xml", entriesRes.Data[0].Path)
+	}
+	res = get("/api/files/" + tarID + "/archive/profiles/TP.xml")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, profile, res.Body.String())
+
+	res = get("/api/files/" + upload("test.csv", []byte("a|b\n1|2\n")) + "/archive")
+	assert.Equal(t, 400, res.Code)
+	assert.Contains(t, res.Body.String(), "invalid_archive")
+}
+
+func TestWebhooks(t *testing.T) {
+	// The receivers of the test run on loopback, which is denied by default
+	router := newTestEngine(t, func(conf *config.Config) {
+		conf.Webhooks.Backoff = 10 * time.Millisecond
+		conf.Webhooks.Attempts = 2
+		conf.Webhooks.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	})
+
+	// The receiver fails the first delivery to have it retried
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	deliveries := make(chan received, 10)
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		deliveries <- received{r.Header, body}
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	tag := "hook=" + uuid.New().String()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/webhooks",
+		bytes.NewBufferString(`{"url": "`+receiver.URL+`", "events": ["file.created"], "tag": "`+tag+`"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var webhookRes *api.ResponseWebhook
+	json.Unmarshal([]byte(w.Body.String()), &webhookRes)
+	webhookID := webhookRes.Data.WebhookID
+	secret := webhookRes.Data.Secret
+	assert.NotEmpty(t, secret)
+
+	// Only the tagged file is delivered
+	router.ServeHTTP(httptest.NewRecorder(), addFileRequest("a|b\n1|2\n"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequestWithTags("result.csv", "a|b\n3|4\n", tag))
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		select {
+		case d := <-deliveries:
+			assert.Equal(t, "file.created", d.header.Get("X-Sogno-Event"))
+			var event events.Event
+			json.Unmarshal(d.body, &event)
+			assert.Equal(t, addFileRes.Data.FileID, event.FileID)
+			assert.Equal(t, "result.csv", event.Path)
+			timestamp, signature, _ := strings.Cut(strings.TrimPrefix(d.header.Get("X-Sogno-Signature"), "t="), ",v1=")
+			assert.Equal(t, webhook.Sign(secret, timestamp, d.body), signature)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery attempt %d did not arrive", attempt)
+		}
+	}
+
+	var deliveriesRes *api.ResponseDeliveries
+	for i := 0; i < 50; i++ {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/webhooks/"+webhookID+"/deliveries", nil)
+		router.ServeHTTP(w, req)
+		json.Unmarshal([]byte(w.Body.String()), &deliveriesRes)
+		if len(deliveriesRes.Data) == 1 && deliveriesRes.Data[0].Status != webhook.StatusPending {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assert.Equal(t, 1, len(deliveriesRes.Data)) {
+		assert.Equal(t, webhook.StatusDelivered, deliveriesRes.Data[0].Status)
+		assert.Equal(t, 2, deliveriesRes.Data[0].Attempts)
+		assert.Equal(t, 200, deliveriesRes.Data[0].StatusCode)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/webhooks", bytes.NewBufferString(`{"url": "ftp://example.com"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), api.ErrorInvalidRequest)
+
+	// Webhooks cannot be sent to denied networks, also not by redirecting
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/webhooks", bytes.NewBufferString(`{"url": "http://169.254.169.254/latest"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), api.ErrorWebhookTargetDenied)
+	redirected := false
+	redirectTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer redirectTarget.Close()
+	redirecting := httptest.NewServer(http.RedirectHandler(redirectTarget.URL, http.StatusFound))
+	defer redirecting.Close()
+	redirectTag := "hook=" + uuid.New().String()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/webhooks",
+		bytes.NewBufferString(`{"url": "`+redirecting.URL+`", "tag": "`+redirectTag+`"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	json.Unmarshal([]byte(w.Body.String()), &webhookRes)
+	router.ServeHTTP(httptest.NewRecorder(), addFileRequestWithTags("result.csv", "a|b\n5|6\n", redirectTag))
+	for i := 0; i < 50; i++ {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/webhooks/"+webhookRes.Data.WebhookID+"/deliveries", nil)
+		router.ServeHTTP(w, req)
+		json.Unmarshal([]byte(w.Body.String()), &deliveriesRes)
+		if len(deliveriesRes.Data) == 1 && deliveriesRes.Data[0].Status == webhook.StatusFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assert.Equal(t, 1, len(deliveriesRes.Data)) {
+		assert.Equal(t, webhook.StatusFailed, deliveriesRes.Data[0].Status)
+		assert.Equal(t, 302, deliveriesRes.Data[0].StatusCode)
+	}
+	assert.False(t, redirected)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/webhooks/"+webhookID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/webhooks/"+webhookID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
+
+// readEvents reads server-sent events until n messages with data arrived
+// and returns their IDs, names and data.
+func readEvents(t *testing.T, r *bufio.Reader, n int) (ids []string, names []string, data []string) {
+	id, name := "", ""
+	for len(data) < n {
+		line, err := r.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ids = append(ids, id)
+			names = append(names, name)
+			data = append(data, strings.TrimPrefix(line, "data: "))
+			id, name = "", ""
+		}
+	}
+	return
+}
+
+func TestFileEvents(t *testing.T) {
+	router := newTestEngine(t, nil)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	tag := "dashboard=" + uuid.New().String()
+	openStream := func(lastEventID string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/api/files/events?tag="+tag, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+		return res
+	}
+	stream := openStream("")
+
+	// Only the events of the tagged file are streamed
+	router.ServeHTTP(httptest.NewRecorder(), addFileRequest("a|b\n1|2\n"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequestWithTags("result.csv", "a|b\n3|4\n", tag))
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	fileID := addFileRes.Data.FileID
+
+	ids, _, data := readEvents(t, bufio.NewReader(stream.Body), 1)
+	stream.Body.Close()
+	var event events.Event
+	json.Unmarshal([]byte(data[0]), &event)
+	assert.Equal(t, events.FileCreated, event.Type)
+	assert.Equal(t, fileID, event.FileID)
+	assert.Equal(t, ids[0], event.ID)
+
+	// Events published while disconnected are sent on resuming
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/api/files/"+fileID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	stream = openStream(ids[0])
+	ids, _, data = readEvents(t, bufio.NewReader(stream.Body), 1)
+	stream.Body.Close()
+	json.Unmarshal([]byte(data[0]), &event)
+	assert.Equal(t, events.FileDeleted, event.Type)
+	assert.Equal(t, fileID, event.FileID)
+
+	// Unknown events have left the history
+	stream = openStream(uuid.New().String())
+	_, names, _ := readEvents(t, bufio.NewReader(stream.Body), 1)
+	stream.Body.Close()
+	assert.Equal(t, "reset", names[0])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files/events?type=file.renamed", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestBrokerEvents(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	// The broker is started after the event, which waits in the outbox
+	var conf config.Config
+	router := newTestEngine(t, func(c *config.Config) {
+		c.Broker = config.BrokerSettings{
+			Type:          "mqtt",
+			URL:           "tcp://" + address,
+			Topic:         "sogno/files/{{.Type}}",
+			QoS:           1,
+			ClientID:      "file-service-test",
+			RetryInterval: 50 * time.Millisecond,
+			Timeout:       5 * time.Second,
+		}
+		conf = *c
+	})
+	client, err := file.NewMinIOClient(conf.MinIOEndpoint, conf.Storage, conf.Timeouts)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	assert.Equal(t, 200, w.Code)
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	fileID := addFileRes.Data.FileID
+
+	outbox := func() []string {
+		var keys []string
+		objInfoChan, err := client.ListObjects(context.Background(), conf.MinIOBucket, ".sogno/outbox/")
+		assert.NoError(t, err)
+		for objInfo := range objInfoChan {
+			keys = append(keys, objInfo.Key)
+		}
+		return keys
+	}
+	// The event is in the outbox once the upload is acknowledged
+	written := false
+	for _, key := range outbox() {
+		if content, err := client.GetObject(context.Background(), conf.MinIOBucket, key); err == nil {
+			body, _ := ioutil.ReadAll(content)
+			content.Close()
+			written = written || strings.Contains(string(body), fileID)
+		}
+	}
+	assert.True(t, written)
+
+	type message struct {
+		topic   string
+		payload []byte
+	}
+	received := make(chan message, 100)
+	server := mqtt.New(&mqtt.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	server.AddHook(new(auth.AllowHook), nil)
+	server.Subscribe("sogno/files/#", 1, func(cl *mqtt.Client, sub packets.Subscription, pk packets.Packet) {
+		select {
+		case received <- message{pk.TopicName, pk.Payload}:
+		default:
+		}
+	})
+	assert.NoError(t, server.AddListener(listeners.NewTCP("tcp", address, nil)))
+	assert.NoError(t, server.Serve())
+	defer server.Close()
+
+	var event events.Event
+	timeout := time.After(10 * time.Second)
+	for event.FileID != fileID {
+		select {
+		case msg := <-received:
+			json.Unmarshal(msg.payload, &event)
+			if event.FileID == fileID {
+				assert.Equal(t, "sogno/files/file.created", msg.topic)
+				assert.Equal(t, events.FileCreated, event.Type)
+			}
+		case <-timeout:
+			t.Fatal("event was not published")
+		}
+	}
+
+	// Published events leave the outbox
+	inOutbox := true
+	for i := 0; i < 50 && inOutbox; i++ {
+		inOutbox = false
+		for _, key := range outbox() {
+			inOutbox = inOutbox || strings.Contains(key, event.ID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, inOutbox)
+}
+
+// notifyingStore passes on the bucket notifications sent by a test, as
+// the S3 server of the tests has none.
+type notifyingStore struct {
+	file.ObjectStore
+	bucket        string
+	notifications chan notification.Info
+}
+
+// ListenBucketNotification closes the channel once ctx is done, like
+// MinIO does.
+func (s *notifyingStore) ListenBucketNotification(ctx context.Context, bucket string) <-chan notification.Info {
+	infos := make(chan notification.Info)
+	go func() {
+		defer close(infos)
+		for bucket == s.bucket {
+			select {
+			case <-ctx.Done():
+				return
+			case info := <-s.notifications:
+				select {
+				case infos <- info:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		<-ctx.Done()
+	}()
+	return infos
+}
+
+func bucketNotification(eventName string, bucket string, key string, size int64) notification.Info {
+	var record notification.Event
+	record.EventName = eventName
+	record.S3.Bucket.Name = bucket
+	record.S3.Object.Key = url.QueryEscape(key)
+	record.S3.Object.Size = size
+	return notification.Info{Records: []notification.Event{record}}
+}
+
+func TestBucketNotifications(t *testing.T) {
+	config.Init()
+	conf := *config.GlobalConfig
+	conf.Notifications.Enabled = true
+	conf.Notifications.Prefixes = []string{"reports/"}
+	bucket := conf.MinIOBucket
+	client, err := file.NewMinIOClient(conf.MinIOEndpoint, conf.Storage, conf.Timeouts)
+	assert.NoError(t, err)
+	store := &notifyingStore{
+		ObjectStore:   file.NewResilientStore(client, conf.Resilience),
+		bucket:        bucket,
+		notifications: make(chan notification.Info),
+	}
+	router, err := routes.NewEngine(&conf, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Close)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/api/files/events")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	stream := bufio.NewReader(res.Body)
+	nextEvent := func() events.Event {
+		var event events.Event
+		if _, _, data := readEvents(t, stream, 1); len(data) == 1 {
+			json.Unmarshal([]byte(data[0]), &event)
+		}
+		return event
+	}
+	ctx := context.Background()
+
+	// Objects outside of the prefixes are left alone
+	other := "backups/" + uuid.New().String() + ".csv"
+	assert.NoError(t, client.PutObject(ctx, bucket, other, strings.NewReader("a|b\n"), 4, "text/csv"))
+	store.notifications <- bucketNotification("s3:ObjectCreated:Put", bucket, other, 4)
+	defer client.DeleteObject(ctx, bucket, other)
+
+	// A file copied into the bucket by another tool gets a file ID
+	name := "summary " + uuid.New().String() + ".csv"
+	content := "a|b\n5|6\n"
+	assert.NoError(t, client.PutObject(ctx, bucket, "reports/"+name, strings.NewReader(content), int64(len(content)), "text/csv"))
+	store.notifications <- bucketNotification("s3:ObjectCreated:Put", bucket, "reports/"+name, int64(len(content)))
+	created := nextEvent()
+	assert.Equal(t, events.FileCreated, created.Type)
+	assert.Equal(t, name, created.Name)
+	assert.Equal(t, "reports/"+name, created.Path)
+	assert.Equal(t, int64(len(content)), created.Size)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/files/"+created.FileID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var getFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &getFileRes)
+	assert.Equal(t, name, getFileRes.Data.Name)
+	assert.NotEmpty(t, getFileRes.Data.CollectionID)
+	assert.Equal(t, int64(len(content)), getFileRes.Data.Size)
+
+	// The object stays where the tool wrote it and is listed with the files
+	_, err = client.StatObject(ctx, bucket, "reports/"+name)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files?collectionID="+getFileRes.Data.CollectionID, nil)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), created.FileID)
+	assert.NotContains(t, w.Body.String(), other)
+
+	// Writing the object again updates the file
+	content = "a|b\n5|6\n7|8\n"
+	assert.NoError(t, client.PutObject(ctx, bucket, "reports/"+name, strings.NewReader(content), int64(len(content)), "text/csv"))
+	store.notifications <- bucketNotification("s3:ObjectCreated:Put", bucket, "reports/"+name, int64(len(content)))
+	updated := nextEvent()
+	assert.Equal(t, events.FileUpdated, updated.Type)
+	assert.Equal(t, created.FileID, updated.FileID)
+
+	// The notifications of the service's own changes are ignored
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, addFileRequest("a|b\n1|2\n"))
+	var addFileRes *api.ResponseFile
+	json.Unmarshal([]byte(w.Body.String()), &addFileRes)
+	uploaded := nextEvent()
+	assert.Equal(t, addFileRes.Data.FileID, uploaded.FileID)
+	store.notifications <- bucketNotification("s3:ObjectCreated:Put", bucket, uploaded.FileID, 8)
+
+	// A file removed by another tool is deleted
+	assert.NoError(t, client.DeleteObject(ctx, bucket, "reports/"+name))
+	store.notifications <- bucketNotification("s3:ObjectRemoved:Delete", bucket, "reports/"+name, 0)
+	deleted := nextEvent()
+	assert.Equal(t, events.FileDeleted, deleted.Type)
+	assert.Equal(t, created.FileID, deleted.FileID)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/files/"+created.FileID, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+
+	// Adopted files are deleted at their keys, also in bulk
+	assert.NoError(t, client.PutObject(ctx, bucket, "reports/"+name, strings.NewReader(content), int64(len(content)), "text/csv"))
+	store.notifications <- bucketNotification("s3:ObjectCreated:Put", bucket, "reports/"+name, int64(len(content)))
+	adopted := nextEvent()
+	assert.Equal(t, events.FileCreated, adopted.Type)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/files/bulk",
+		bytes.NewBufferString(`{"operation": "delete", "fileIDs": ["`+adopted.FileID+`"]}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var bulkRes *api.ResponseBulk
+	json.Unmarshal([]byte(w.Body.String()), &bulkRes)
+	if assert.Equal(t, 1, len(bulkRes.Data)) {
+		assert.Equal(t, adopted.FileID, bulkRes.Data[0].FileID)
+		assert.Equal(t, 200, bulkRes.Data[0].Code)
+	}
+	deleted = nextEvent()
+	assert.Equal(t, events.FileDeleted, deleted.Type)
+	assert.Equal(t, adopted.FileID, deleted.FileID)
+	_, err = client.StatObject(ctx, bucket, "reports/"+name)
+	assert.Error(t, err)
+}
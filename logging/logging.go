@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sogno-platform/file-service/config"
+)
+
+// RequestIDHeader carries the ID of a request from and to the client.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs passed in by clients.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// New returns a logger writing to stderr with settings.
+func New(settings config.LogSettings) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(settings.Level)); err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if settings.Format == "text" {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	return slog.New(handler), nil
+}
+
+// WithLogger returns a copy of ctx whose logs go to the logger currently
+// held by logger.
+func WithLogger(ctx context.Context, logger *config.Value[*slog.Logger]) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the logger of ctx, or the default logger, with the
+// request and trace IDs of ctx attached.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if value, ok := ctx.Value(loggerKey{}).(*config.Value[*slog.Logger]); ok {
+		logger = value.Load()
+	}
+	if requestID := RequestID(ctx); requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		logger = logger.With("trace_id", spanContext.TraceID().String())
+	}
+	return logger
+}
+
+// validRequestID accepts IDs of printable ASCII characters, so clients
+// cannot inject line breaks or control characters into the logs.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NextWithContext runs the pending handlers with ctx as the context of the
+// request. The forms they parse are kept on the request of the caller, as
+// if its context had not been replaced.
+func NextWithContext(c *gin.Context, ctx context.Context) {
+	req := c.Request
+	c.Request = req.WithContext(ctx)
+	defer func() {
+		req.Form, req.PostForm, req.MultipartForm = c.Request.Form, c.Request.PostForm, c.Request.MultipartForm
+		c.Request = req
+	}()
+	c.Next()
+}
+
+// Middleware takes the request ID from the X-Request-ID header or generates
+// one, returns it in the response and logs every request to logger once it
+// is done. It replaces Gin's default logger.
+func Middleware(logger *config.Value[*slog.Logger]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Header(RequestIDHeader, requestID)
+		ctx := WithRequestID(WithLogger(c.Request.Context(), logger), requestID)
+
+		NextWithContext(c, ctx)
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		FromContext(ctx).Log(ctx, level, "request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		)
+	}
+}
@@ -3,28 +3,57 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log"
 	"net/http"
-
-	"github.com/gin-gonic/gin"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/sogno-platform/file-service/config"
 	"github.com/sogno-platform/file-service/routes"
 )
 
-func setupRouter() *gin.Engine {
-	config.Init()
+// shutdownTimeout bounds how long running requests may delay the exit.
+const shutdownTimeout = 10 * time.Second
 
-	r := gin.Default()
+func setupRouter() *routes.Engine {
+	config.Init()
 
-	r.GET("", func(c *gin.Context) {
-		c.Redirect(http.StatusMovedPermanently, "/api/docs/index.html")
-	})
-	api := r.Group("/api")
-	routes.RegisterEndpoints(api)
+	r, err := routes.NewEngine(config.GlobalConfig, nil)
+	if err != nil {
+		log.Fatalln("Error setting up service: " + err.Error())
+	}
 	return r
 }
 
 func main() {
+	flag.Parse()
 	r := setupRouter()
-	r.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+	defer r.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go config.Watch(ctx)
+
+	// listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	server := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln(err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error finishing requests: " + err.Error())
+	}
 }
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "file_service"
+
+// Results of storage operations
+const (
+	ResultOK       = "ok"
+	ResultNotFound = "not_found"
+	ResultError    = "error"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	storageOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operations_total",
+		Help:      "Operations on the object store by operation and result.",
+	}, []string{"operation", "result"})
+
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of operations on the object store by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	storageRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_retries_total",
+		Help:      "Retried operations on the object store by operation.",
+	}, []string{"operation"})
+
+	storageCircuitState = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_circuit_state",
+		Help:      "State of the circuit breaker of the object store (0 closed, 1 half-open, 2 open).",
+	})
+
+	uploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_uploaded_bytes_total",
+		Help:      "Bytes written to the object store.",
+	})
+
+	downloadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_downloaded_bytes_total",
+		Help:      "Bytes read from the object store.",
+	})
+
+	expiredFiles = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "expired_files_total",
+		Help:      "Expired files deleted by the reaper.",
+	})
+
+	purgedFiles = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purged_files_total",
+		Help:      "Files purged from the trash by the reaper.",
+	})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by result: delivered, retried or failed.",
+	}, []string{"result"})
+
+	brokerEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_events_total",
+		Help:      "Attempts to publish events to the message broker by result: published, failed or dropped.",
+	}, []string{"result"})
+
+	bucketNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bucket_notifications_total",
+		Help:      "Bucket notifications about changes made by other tools by result: applied, ignored or failed.",
+	}, []string{"result"})
+
+	brokerOutbox = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "broker_outbox_events",
+		Help:      "Events waiting in the outbox to be published to the message broker.",
+	})
+)
+
+func RegisterMetricsEndpoints(r gin.IRoutes) {
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
+
+// Middleware counts requests and measures their latency. Requests are
+// labelled by route template, so path parameters don't create new series.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveStorage records an operation on the object store.
+func ObserveStorage(operation string, duration time.Duration, result string) {
+	storageOperations.WithLabelValues(operation, result).Inc()
+	storageDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+func AddStorageRetry(operation string) {
+	storageRetries.WithLabelValues(operation).Inc()
+}
+
+func SetStorageCircuitState(state int) {
+	storageCircuitState.Set(float64(state))
+}
+
+func AddUploadedBytes(n int64) {
+	uploadedBytes.Add(float64(n))
+}
+
+func AddDownloadedBytes(n int64) {
+	downloadedBytes.Add(float64(n))
+}
+
+func AddExpiredFiles(n int) {
+	expiredFiles.Add(float64(n))
+}
+
+func AddPurgedFiles(n int) {
+	purgedFiles.Add(float64(n))
+}
+
+func AddWebhookDelivery(result string) {
+	webhookDeliveries.WithLabelValues(result).Inc()
+}
+
+func AddBrokerEvent(result string) {
+	brokerEvents.WithLabelValues(result).Inc()
+}
+
+func SetBrokerOutbox(n int) {
+	brokerOutbox.Set(float64(n))
+}
+
+func AddBucketNotification(result string) {
+	bucketNotifications.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package project
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/file"
+)
+
+func RegisterProjectEndpoints(r *gin.RouterGroup, controller *ProjectController) {
+	r.GET("", controller.GetProjects)
+	r.GET("/:projectID", controller.GetProject)
+	file.RegisterFileEndpoints(r.Group("/:projectID/files"), controller.Resolve)
+	file.RegisterCollectionEndpoints(r.Group("/:projectID/collections"), controller.Resolve)
+	file.RegisterTrashEndpoints(r.Group("/:projectID/trash"), controller.Resolve)
+}
+
+type ProjectController struct {
+	Projects map[string]config.Project
+	// File controllers by project ID
+	Files map[string]*file.FileController
+}
+
+func NewProjectController(store file.ObjectStore, projects map[string]config.Project, settings file.ControllerSettings) (*ProjectController, error) {
+	controller := &ProjectController{
+		Projects: projects,
+		Files:    make(map[string]*file.FileController),
+	}
+	for projectID, project := range projects {
+		files, err := file.NewFileController(store, project.Bucket, project.Prefix, settings)
+		if err != nil {
+			return nil, err
+		}
+		files.Projects = controller.FileController
+		files.ProjectID = projectID
+		controller.Files[projectID] = files
+	}
+	return controller, nil
+}
+
+// FileController returns the file controller of a project.
+func (p *ProjectController) FileController(projectID string) (*file.FileController, bool) {
+	files, ok := p.Files[projectID]
+	return files, ok
+}
+
+// Resolve returns the file controller of the project in the request path.
+func (p *ProjectController) Resolve(c *gin.Context) (*file.FileController, bool) {
+	projectID := c.Param("projectID")
+	files, ok := p.Files[projectID]
+	if !ok {
+		api.ErrorJSON(c, http.StatusNotFound, &api.Error{
+			Code:    api.ErrorProjectNotFound,
+			Message: "project not found: " + projectID,
+		})
+	}
+	return files, ok
+}
+
+// GetProjects godoc
+// @Summary Get all projects
+// @Description Each project has its own namespace of files and collections.
+// @Description The endpoints below /files and /collections are available for a
+// @Description single project below /projects/{projectID}/files and
+// @Description /projects/{projectID}/collections.
+// @ID GetProjects
+// @Tags projects
+// @Produce json
+// @Success 200 {object} api.ResponseProjects "Projects available"
+// @Router /projects [get]
+func (p *ProjectController) GetProjects(c *gin.Context) {
+
+	projects := []api.ResponseProjectData{}
+	for projectID, project := range p.Projects {
+		projects = append(projects, api.ResponseProjectData{
+			ProjectID: projectID,
+			Name:      project.Name,
+		})
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].ProjectID < projects[j].ProjectID
+	})
+	c.PureJSON(http.StatusOK, api.ResponseProjects{Data: projects})
+}
+
+// GetProject godoc
+// @Summary Get project info
+// @ID GetProject
+// @Tags projects
+// @Produce json
+// @Success 200 {object} api.ResponseProject "Project info"
+// @Failure 404 {object} api.ResponseError "Project not found"
+// @Param projectID path string true "ID of project"
+// @Router /projects/{projectID} [get]
+func (p *ProjectController) GetProject(c *gin.Context) {
+
+	projectID := c.Param("projectID")
+	project, ok := p.Projects[projectID]
+	if !ok {
+		api.ErrorJSON(c, http.StatusNotFound, &api.Error{
+			Code:    api.ErrorProjectNotFound,
+			Message: "project not found: " + projectID,
+		})
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseProject{
+		Data: api.ResponseProjectData{
+			ProjectID: projectID,
+			Name:      project.Name,
+		},
+	})
+}
@@ -3,19 +3,263 @@
 package routes
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
 
+	"github.com/sogno-platform/file-service/broker"
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/cors"
 	"github.com/sogno-platform/file-service/docs"
+	"github.com/sogno-platform/file-service/events"
 	"github.com/sogno-platform/file-service/file"
+	"github.com/sogno-platform/file-service/health"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+	"github.com/sogno-platform/file-service/project"
+	"github.com/sogno-platform/file-service/tracing"
+	"github.com/sogno-platform/file-service/webhook"
 )
 
-func RegisterEndpoints(r *gin.RouterGroup) {
+// shutdownTimeout bounds how long Close waits for buffered spans to be
+// exported.
+const shutdownTimeout = 10 * time.Second
 
+func init() {
 	docs.SwaggerInfo_swagger.BasePath = "/api"
-	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+}
+
+// Engine is a router serving the whole service. It has its own logger and
+// tracer provider, so engines with different configs can run side by
+// side. Close stops its background work.
+type Engine struct {
+	*gin.Engine
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	closers []func()
+}
+
+// NewEngine returns an engine serving the service with conf. If store is
+// nil, the buckets are provisioned and a MinIO client for conf is created.
+// Engines built from config.GlobalConfig follow config reloads.
+func NewEngine(conf *config.Config, store file.ObjectStore) (*Engine, error) {
 
-	file.RegisterFileEndpoints(r.Group("/files"))
+	// Requests are logged by the logging middleware
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	r.GET("", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/api/docs/index.html")
+	})
+	e := &Engine{Engine: r}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	if err := e.registerEndpoints(conf, store); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Close stops the background work of the engine and then releases what it
+// holds, exporting the spans that are still buffered last.
+func (e *Engine) Close() {
+	e.cancel()
+	e.wg.Wait()
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		e.closers[i]()
+	}
+	e.closers = nil
+}
+
+// run does work in the background until the engine is closed.
+func (e *Engine) run(work func(ctx context.Context)) {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		work(e.ctx)
+	}()
+}
+
+// registerEndpoints adds the middleware, endpoints and background work of
+// the service. See NewEngine for store.
+func (e *Engine) registerEndpoints(conf *config.Config, store file.ObjectStore) error {
+
+	l, err := logging.New(conf.Log)
+	if err != nil {
+		return fmt.Errorf("setting up logging: %w", err)
+	}
+	logger := config.NewValue(l)
+	provider, shutdown, err := tracing.NewProvider(conf.Tracing)
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	e.closers = append(e.closers, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logger.Load().Error("exporting spans", "error", err)
+		}
+	})
+	// Background work logs and traces like requests do
+	e.ctx = tracing.WithProvider(logging.WithLogger(e.ctx, logger), provider)
+
+	r := e.Engine
+	r.Use(logging.Middleware(logger))
+	corsSettings := config.NewValue(conf.CORS)
+	r.Use(cors.Middleware(corsSettings))
+	r.Use(tracing.Middleware(provider))
+	r.Use(metrics.Middleware())
+	metrics.RegisterMetricsEndpoints(r)
+
+	var client *file.MinIOClient
+	if store == nil {
+		client, err = file.NewMinIOClient(conf.MinIOEndpoint, conf.Storage, conf.Timeouts)
+		if err != nil {
+			return err
+		}
+		if err := provisionBuckets(conf, client); err != nil {
+			return fmt.Errorf("provisioning buckets: %w", err)
+		}
+		store = file.NewResilientStore(client, conf.Resilience)
+	}
+	// Changes of the service are told apart from those of other tools
+	var tracking *file.TrackingStore
+	if conf.Notifications.Enabled {
+		tracking = file.NewTrackingStore(store)
+		store = tracking
+	}
+	upload := config.NewValue(conf.Upload)
+	bus := events.NewBus(conf.Events.History)
+	settings := file.ControllerSettings{
+		Upload:         upload,
+		ExpiryRules:    conf.Expiry.Rules,
+		TrashRetention: conf.Trash.Retention,
+		Events:         bus,
+		EventHeartbeat: conf.Events.Heartbeat,
+	}
+	controller, err := file.NewFileController(store, conf.MinIOBucket, "", settings)
+	if err != nil {
+		return err
+	}
+	projects, err := project.NewProjectController(store, conf.Projects, settings)
+	if err != nil {
+		return err
+	}
+	controller.Projects = projects.FileController
+	controllers := []*file.FileController{controller}
+	for _, files := range projects.Files {
+		controllers = append(controllers, files)
+	}
+	// Background work must not read conf, which callers may change once
+	// the engine is built
+	if interval := conf.Expiry.ReapInterval; interval > 0 {
+		e.run(func(ctx context.Context) {
+			file.RunReaper(ctx, interval, controllers...)
+		})
+	}
+	if interval := conf.Trash.PurgeInterval; conf.Trash.Retention > 0 && interval > 0 {
+		e.run(func(ctx context.Context) {
+			file.RunPurger(ctx, interval, controllers...)
+		})
+	}
+	if tracking != nil {
+		listener, ok := tracking.ObjectStore.(file.BucketListener)
+		if !ok {
+			return errors.New("object store does not support bucket notifications")
+		}
+		reconciler := file.NewReconciler(tracking, conf.Notifications, controllers...)
+		for _, bucket := range buckets(conf) {
+			bucket := bucket
+			e.run(func(ctx context.Context) {
+				reconciler.Run(ctx, listener, bucket)
+			})
+		}
+	}
+	webhooks, err := webhook.NewWebhookController(e.ctx, store, conf.MinIOBucket, conf.Webhooks)
+	if err != nil {
+		return err
+	}
+	bus.Subscribe(webhooks.Publish)
+	e.run(webhooks.Run)
+	if conf.Broker.Type != "" {
+		publisher, err := broker.NewPublisher(conf.Broker)
+		if err != nil {
+			return err
+		}
+		outbox, err := broker.NewOutbox(e.ctx, store, conf.MinIOBucket, publisher, conf.Broker)
+		if err != nil {
+			publisher.Close()
+			return fmt.Errorf("setting up broker: %w", err)
+		}
+		bus.Subscribe(outbox.Publish)
+		e.run(outbox.Run)
+	}
+
+	// Reloads replace the global config, other configs stay as they are
+	if conf == config.GlobalConfig {
+		unsubscribe := config.OnReload(func(reloaded *config.Config) {
+			if l, err := logging.New(reloaded.Log); err != nil {
+				logger.Load().Error("applying log settings", "error", err)
+			} else {
+				logger.Store(l)
+			}
+			corsSettings.Store(reloaded.CORS)
+			upload.Store(reloaded.Upload)
+			if client != nil {
+				client.Reconfigure(reloaded.Storage)
+			}
+		})
+		e.closers = append(e.closers, unsubscribe)
+	}
+
+	healthController := health.NewHealthController()
+	for _, bucket := range buckets(conf) {
+		bucket := bucket
+		healthController.AddCheck("bucket:"+bucket, func(ctx context.Context) error {
+			return store.CheckBucket(ctx, bucket)
+		})
+	}
+	health.RegisterHealthEndpoints(r, healthController)
+
+	api := r.Group("/api")
+	api.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	file.RegisterFileEndpoints(api.Group("/files"), file.StaticResolver(controller))
+	file.RegisterCollectionEndpoints(api.Group("/collections"), file.StaticResolver(controller))
+	file.RegisterTrashEndpoints(api.Group("/trash"), file.StaticResolver(controller))
+	project.RegisterProjectEndpoints(api.Group("/projects"), projects)
+	webhook.RegisterWebhookEndpoints(api.Group("/webhooks"), webhooks)
+	return nil
+}
+
+// buckets returns the distinct buckets of the service and all projects.
+func buckets(c *config.Config) []string {
+	buckets := []string{c.MinIOBucket}
+	seen := map[string]bool{c.MinIOBucket: true}
+	for _, project := range c.Projects {
+		if !seen[project.Bucket] {
+			buckets = append(buckets, project.Bucket)
+			seen[project.Bucket] = true
+		}
+	}
+	return buckets
+}
 
+// provisionBuckets prepares the buckets of the service and all projects.
+func provisionBuckets(c *config.Config, client *file.MinIOClient) error {
+	for _, bucket := range buckets(c) {
+		if err := client.ProvisionBucket(bucket, c.Bucket); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/logging"
+)
+
+const serviceName = "sogno-file-service"
+
+type providerKey struct{}
+
+// propagator reads and writes W3C trace context and baggage headers.
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// NewProvider returns the tracer provider for settings and a function that
+// exports the spans that are still buffered and stops the provider.
+// Without an exporter, spans are not recorded but incoming trace context
+// is still passed on.
+func NewProvider(settings config.TracingSettings) (trace.TracerProvider, func(ctx context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch settings.Exporter {
+	case "":
+		return trace.NewNoopTracerProvider(), func(ctx context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if settings.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(settings.Endpoint))
+		}
+		if settings.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		err = fmt.Errorf("unknown tracing exporter '%s'", settings.Exporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(settings.SampleRatio))),
+	)
+	return provider, provider.Shutdown, nil
+}
+
+// WithProvider returns a copy of ctx whose spans are created by provider.
+func WithProvider(ctx context.Context, provider trace.TracerProvider) context.Context {
+	return context.WithValue(ctx, providerKey{}, provider)
+}
+
+// Tracer returns the tracer called name of the provider of ctx. Without a
+// provider, spans are not recorded.
+func Tracer(ctx context.Context, name string) trace.Tracer {
+	provider, ok := ctx.Value(providerKey{}).(trace.TracerProvider)
+	if !ok {
+		provider = trace.NewNoopTracerProvider()
+	}
+	return provider.Tracer(name)
+}
+
+// Middleware starts a span with provider for each request, continuing the
+// trace of the caller if the request carries a traceparent header.
+// Handlers find the span and the provider in the context of the request.
+func Middleware(provider trace.TracerProvider) gin.HandlerFunc {
+	tracer := provider.Tracer("github.com/sogno-platform/file-service/tracing")
+	return func(c *gin.Context) {
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx = WithProvider(ctx, provider)
+
+		route := c.FullPath()
+		spanName := c.Request.Method + " " + route
+		if route == "" {
+			spanName = c.Request.Method
+		}
+		ctx, span := tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(serviceName, route, c.Request)...),
+		)
+		defer span.End()
+
+		logging.NextWithContext(c, ctx)
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package webhook posts the events of files to the URLs subscribed to them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/config"
+	"github.com/sogno-platform/file-service/events"
+	"github.com/sogno-platform/file-service/file"
+	"github.com/sogno-platform/file-service/logging"
+	"github.com/sogno-platform/file-service/metrics"
+)
+
+// keyPrefix is where webhooks are kept, next to the records of the files.
+const keyPrefix = ".sogno/webhooks/"
+
+// queueSize is the number of deliveries waiting to be sent. Events for
+// which the queue is full are not delivered.
+const queueSize = 1000
+
+// Status of deliveries
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+var errWebhookDeleted = errors.New("webhook was deleted")
+
+type Webhook struct {
+	WebhookID string        `json:"webhookID"`
+	URL       string        `json:"url"`
+	Secret    string        `json:"secret"`
+	Filter    events.Filter `json:"filter"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// delivery is an event on its way to a webhook.
+type delivery struct {
+	webhookID string
+	event     events.Event
+	body      []byte
+	// Entry in the delivery log, guarded by the controller's lock
+	record *api.ResponseDeliveryData
+}
+
+// WebhookController keeps the webhooks in memory, persists them as JSON
+// objects in the bucket and delivers the events to them.
+type WebhookController struct {
+	objStore file.ObjectStore
+	bucket   string
+	settings config.WebhookSettings
+	guard    targetGuard
+	client   *http.Client
+	queue    chan *delivery
+
+	mu       sync.RWMutex
+	webhooks map[string]Webhook
+	// Latest deliveries by webhook, oldest first
+	logs map[string][]*api.ResponseDeliveryData
+}
+
+func NewWebhookController(ctx context.Context, store file.ObjectStore, bucket string, settings config.WebhookSettings) (*WebhookController, error) {
+	guard := newTargetGuard(settings)
+	w := &WebhookController{
+		objStore: store,
+		bucket:   bucket,
+		settings: settings,
+		guard:    guard,
+		client:   newClient(guard),
+		queue:    make(chan *delivery, queueSize),
+		webhooks: make(map[string]Webhook),
+		logs:     make(map[string][]*api.ResponseDeliveryData),
+	}
+	err := w.load(ctx)
+	return w, err
+}
+
+func (w *WebhookController) load(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objInfoChan, err := w.objStore.ListObjects(ctx, w.bucket, keyPrefix)
+	if err != nil {
+		return err
+	}
+	for objInfo := range objInfoChan {
+		if objInfo.Err != nil {
+			return objInfo.Err
+		}
+		if strings.HasSuffix(objInfo.Key, "/") {
+			continue
+		}
+		content, err := w.objStore.GetObject(ctx, w.bucket, objInfo.Key)
+		if err != nil {
+			return err
+		}
+		var hook Webhook
+		err = json.NewDecoder(content).Decode(&hook)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("reading webhook %s: %w", objInfo.Key, err)
+		}
+		w.webhooks[hook.WebhookID] = hook
+	}
+	return nil
+}
+
+func (w *WebhookController) key(webhookID string) string {
+	return keyPrefix + webhookID + ".json"
+}
+
+// Webhook returns the webhook with the given ID.
+func (w *WebhookController) Webhook(webhookID string) (Webhook, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	hook, ok := w.webhooks[webhookID]
+	return hook, ok
+}
+
+func (w *WebhookController) add(ctx context.Context, hook Webhook) error {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	if err := w.objStore.PutObject(ctx, w.bucket, w.key(hook.WebhookID), bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.webhooks[hook.WebhookID] = hook
+	return nil
+}
+
+func (w *WebhookController) delete(ctx context.Context, webhookID string) error {
+	if err := w.objStore.DeleteObject(ctx, w.bucket, w.key(webhookID)); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.webhooks, webhookID)
+	delete(w.logs, webhookID)
+	return nil
+}
+
+// Publish queues the deliveries of an event to the webhooks whose filter
+// matches it. It does not block, events are dropped if too many
+// deliveries are waiting.
+func (w *WebhookController) Publish(ctx context.Context, e events.Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		logging.FromContext(ctx).Error("encoding event", "event_id", e.ID, "error", err)
+		return
+	}
+
+	var deliveries []*delivery
+	now := time.Now().UTC()
+	w.mu.Lock()
+	for _, hook := range w.webhooks {
+		if !hook.Filter.Matches(e) {
+			continue
+		}
+		d := &delivery{
+			webhookID: hook.WebhookID,
+			event:     e,
+			body:      body,
+			record: &api.ResponseDeliveryData{
+				DeliveryID: uuid.New().String(),
+				EventID:    e.ID,
+				EventType:  e.Type,
+				FileID:     e.FileID,
+				Status:     StatusPending,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			},
+		}
+		log := append(w.logs[hook.WebhookID], d.record)
+		if len(log) > w.settings.LogSize {
+			log = log[len(log)-w.settings.LogSize:]
+		}
+		w.logs[hook.WebhookID] = log
+		deliveries = append(deliveries, d)
+	}
+	w.mu.Unlock()
+
+	for _, d := range deliveries {
+		w.enqueue(d)
+	}
+}
+
+func (w *WebhookController) enqueue(d *delivery) {
+	select {
+	case w.queue <- d:
+	default:
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		d.record.Status = StatusFailed
+		d.record.Error = "delivery queue is full"
+		d.record.UpdatedAt = time.Now().UTC()
+		metrics.AddWebhookDelivery(StatusFailed)
+	}
+}
+
+// Deliveries returns the latest deliveries of a webhook, most recent
+// first.
+func (w *WebhookController) Deliveries(webhookID string) []api.ResponseDeliveryData {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	log := w.logs[webhookID]
+	deliveries := make([]api.ResponseDeliveryData, len(log))
+	for i, record := range log {
+		deliveries[len(log)-1-i] = *record
+	}
+	return deliveries
+}
+
+// Run sends the queued deliveries until ctx is done.
+func (w *WebhookController) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < w.settings.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-w.queue:
+					w.attempt(ctx, d)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// attempt sends a delivery and schedules a retry if it fails. The wait
+// before a retry doubles with every attempt.
+func (w *WebhookController) attempt(ctx context.Context, d *delivery) {
+	statusCode, err := w.send(ctx, d)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	d.record.Attempts++
+	d.record.StatusCode = statusCode
+	d.record.UpdatedAt = time.Now().UTC()
+	d.record.Error = ""
+	switch {
+	case err == nil:
+		d.record.Status = StatusDelivered
+		metrics.AddWebhookDelivery(StatusDelivered)
+	case errors.Is(err, errWebhookDeleted) || d.record.Attempts >= w.settings.Attempts:
+		d.record.Status = StatusFailed
+		d.record.Error = err.Error()
+		metrics.AddWebhookDelivery(StatusFailed)
+	default:
+		d.record.Error = err.Error()
+		metrics.AddWebhookDelivery("retried")
+		backoff := w.settings.Backoff << (d.record.Attempts - 1)
+		time.AfterFunc(backoff, func() { w.enqueue(d) })
+	}
+}
+
+// send posts the event of a delivery to its webhook. Responses other than
+// 2xx count as failures.
+func (w *WebhookController) send(ctx context.Context, d *delivery) (int, error) {
+	hook, ok := w.Webhook(d.webhookID)
+	if !ok {
+		return 0, errWebhookDeleted
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.settings.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sogno-file-service")
+	req.Header.Set("X-Sogno-Event", d.event.Type)
+	req.Header.Set("X-Sogno-Delivery", d.record.DeliveryID)
+	req.Header.Set("X-Sogno-Signature", "t="+timestamp+",v1="+Sign(hook.Secret, timestamp, d.body))
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver answered %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// Sign returns the signature of a delivery sent at timestamp (Unix
+// seconds): the hex-encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// the secret of the webhook.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/events"
+	"github.com/sogno-platform/file-service/file"
+)
+
+func RegisterWebhookEndpoints(r *gin.RouterGroup, controller *WebhookController) {
+	r.GET("", controller.GetWebhooks)
+	r.POST("", controller.AddWebhook)
+	r.GET("/:webhookID", controller.GetWebhook)
+	r.DELETE("/:webhookID", controller.DeleteWebhook)
+	r.GET("/:webhookID/deliveries", controller.GetDeliveries)
+}
+
+func webhookData(hook Webhook) api.ResponseWebhookData {
+	types := hook.Filter.Types
+	if types == nil {
+		types = []string{}
+	}
+	return api.ResponseWebhookData{
+		WebhookID: hook.WebhookID,
+		URL:       hook.URL,
+		Events:    types,
+		ProjectID: hook.Filter.ProjectID,
+		Prefix:    hook.Filter.Prefix,
+		Tag:       hook.Filter.Tag,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+// pathWebhook returns the webhook in the request path. Otherwise it writes
+// an error response and returns false.
+func (w *WebhookController) pathWebhook(c *gin.Context) (Webhook, bool) {
+	webhookID := c.Param("webhookID")
+	hook, ok := w.Webhook(webhookID)
+	if !ok {
+		api.ErrorJSON(c, http.StatusNotFound, &api.Error{
+			Code:    api.ErrorWebhookNotFound,
+			Message: "webhook not found: " + webhookID,
+		})
+	}
+	return hook, ok
+}
+
+// newWebhook checks a request for a webhook and returns the webhook. The
+// host of its URL must not resolve to a denied network.
+func (w *WebhookController) newWebhook(ctx context.Context, req api.RequestWebhook) (Webhook, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, &api.Error{
+			Code:    api.ErrorInvalidRequest,
+			Message: "invalid url '" + req.URL + "', expected an http or https URL",
+		}
+	}
+	if err := w.guard.check(ctx, u.Hostname()); err != nil {
+		return Webhook{}, err
+	}
+	filter := events.Filter{
+		Types:     req.Events,
+		ProjectID: req.ProjectID,
+		Prefix:    req.Prefix,
+		Tag:       req.Tag,
+	}
+	if err := filter.Validate(); err != nil {
+		return Webhook{}, &api.Error{Code: api.ErrorInvalidRequest, Message: err.Error(), Err: err}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return Webhook{}, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+	return Webhook{
+		WebhookID: uuid.New().String(),
+		URL:       req.URL,
+		Secret:    secret,
+		Filter:    filter,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// GetWebhooks godoc
+// @Summary Get all webhooks
+// @ID GetWebhooks
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} api.ResponseWebhooks "Webhooks, oldest first"
+// @Router /webhooks [get]
+func (w *WebhookController) GetWebhooks(c *gin.Context) {
+
+	w.mu.RLock()
+	hooks := make([]Webhook, 0, len(w.webhooks))
+	for _, hook := range w.webhooks {
+		hooks = append(hooks, hook)
+	}
+	w.mu.RUnlock()
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+
+	data := make([]api.ResponseWebhookData, len(hooks))
+	for i, hook := range hooks {
+		data[i] = webhookData(hook)
+	}
+	c.PureJSON(http.StatusOK, api.ResponseWebhooks{Data: data})
+}
+
+// AddWebhook godoc
+// @Summary Subscribe to the events of files
+// @Description Events are posted as JSON to the URL, signed with the secret of the webhook in the
+// @Description X-Sogno-Signature header. Failed deliveries are retried with backoff. The secret is
+// @Description only returned here. URLs of hosts in the denied networks of the webhooks settings, by
+// @Description default loopback, link-local and private ones, are rejected.
+// @ID AddWebhook
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.ResponseWebhook "Webhook that was added, with its secret"
+// @Failure 400 {object} api.ResponseError "Bad request, or a webhook URL in a denied network"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param webhook body api.RequestWebhook true "URL and filter of webhook"
+// @Router /webhooks [post]
+func (w *WebhookController) AddWebhook(c *gin.Context) {
+
+	var req api.RequestWebhook
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	hook, err := w.newWebhook(c.Request.Context(), req)
+	if err != nil {
+		api.ErrorJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := w.add(c.Request.Context(), hook); err != nil {
+		file.StorageErrorJSON(c, err)
+		return
+	}
+	data := webhookData(hook)
+	data.Secret = hook.Secret
+	c.PureJSON(http.StatusOK, api.ResponseWebhook{Data: data})
+}
+
+// GetWebhook godoc
+// @Summary Get webhook
+// @ID GetWebhook
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} api.ResponseWebhook "Webhook"
+// @Failure 404 {object} api.ResponseError "Webhook not found"
+// @Param webhookID path string true "ID of webhook"
+// @Router /webhooks/{webhookID} [get]
+func (w *WebhookController) GetWebhook(c *gin.Context) {
+
+	hook, ok := w.pathWebhook(c)
+	if !ok {
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseWebhook{Data: webhookData(hook)})
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Pending deliveries are dropped.
+// @ID DeleteWebhook
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} api.ResponseEmpty "Webhook was deleted"
+// @Failure 404 {object} api.ResponseError "Webhook not found"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Failure 503 {object} api.ResponseError "Object store is unavailable"
+// @Failure 504 {object} api.ResponseError "Object store timed out"
+// @Param webhookID path string true "ID of webhook"
+// @Router /webhooks/{webhookID} [delete]
+func (w *WebhookController) DeleteWebhook(c *gin.Context) {
+
+	hook, ok := w.pathWebhook(c)
+	if !ok {
+		return
+	}
+	if err := w.delete(c.Request.Context(), hook.WebhookID); err != nil {
+		file.StorageErrorJSON(c, err)
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseEmpty{})
+}
+
+// GetDeliveries godoc
+// @Summary Get the latest deliveries of a webhook
+// @Description The log is kept in memory and holds the latest deliveries up to webhooks.log_size.
+// @ID GetDeliveries
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} api.ResponseDeliveries "Deliveries, most recent first"
+// @Failure 404 {object} api.ResponseError "Webhook not found"
+// @Param webhookID path string true "ID of webhook"
+// @Router /webhooks/{webhookID}/deliveries [get]
+func (w *WebhookController) GetDeliveries(c *gin.Context) {
+
+	hook, ok := w.pathWebhook(c)
+	if !ok {
+		return
+	}
+	c.PureJSON(http.StatusOK, api.ResponseDeliveries{Data: w.Deliveries(hook.WebhookID)})
+}
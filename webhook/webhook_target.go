@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/sogno-platform/file-service/api"
+	"github.com/sogno-platform/file-service/config"
+)
+
+// targetGuard keeps webhooks from reaching into the networks of the
+// service, e.g. the metadata endpoint of a cloud provider.
+type targetGuard struct {
+	denied  []netip.Prefix
+	allowed []netip.Prefix
+}
+
+func newTargetGuard(settings config.WebhookSettings) targetGuard {
+	return targetGuard{denied: settings.DeniedNetworks, allowed: settings.AllowedNetworks}
+}
+
+// permits tells whether webhooks may be sent to addr. Allowed networks
+// take precedence over denied ones.
+func (g targetGuard) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range g.allowed {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	for _, network := range g.denied {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// check resolves host and returns an error if any of its addresses is not
+// permitted.
+func (g targetGuard) check(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return &api.Error{
+			Code:    api.ErrorInvalidRequest,
+			Message: fmt.Sprintf("cannot resolve host '%s'", host),
+			Err:     err,
+		}
+	}
+	for _, addr := range addrs {
+		if !g.permits(addr) {
+			return &api.Error{
+				Code:    api.ErrorWebhookTargetDenied,
+				Message: fmt.Sprintf("host '%s' is in a network webhooks must not be sent to", host),
+			}
+		}
+	}
+	return nil
+}
+
+// control refuses connections to addresses that are not permitted. It
+// sees the address actually dialed, so hosts that resolve differently
+// than when their webhook was added are refused as well.
+func (g targetGuard) control(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !g.permits(addrPort.Addr()) {
+		return fmt.Errorf("%s is in a network webhooks must not be sent to", addrPort.Addr())
+	}
+	return nil
+}
+
+// newClient returns a client that only connects to permitted addresses. It
+// uses no proxy, which would hide the address of the receiver, and does not
+// follow redirects, so responses with them count as failures.
+func newClient(guard targetGuard) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   guard.control,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}